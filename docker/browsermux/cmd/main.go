@@ -3,36 +3,76 @@ package main
 import (
 	"context"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"browsermux/internal/api"
 	"browsermux/internal/browser"
 	"browsermux/internal/config"
+	"browsermux/internal/logging"
+	"browsermux/internal/recording"
+	"browsermux/internal/tracing"
+	"browsermux/internal/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		runReplay(os.Args[2:])
+		return
+	}
+
 	portFlag := flag.String("port", "", "Port to listen on")
 	browserURLFlag := flag.String("browser-url", "", "Browser DevTools URL to proxy")
 	maxMessageSizeFlag := flag.Int("max-message-size", -1, "Maximum message size in bytes")
 	connectionTimeoutFlag := flag.Int("connection-timeout", -1, "Connection timeout in seconds")
 	configPathFlag := flag.String("config", "", "Optional path to JSON config file")
+	lockModeFlag := flag.String("lock-mode", "", "Session lock mode: exclusive, shared or controller+observers")
+	slowConsumerPolicyFlag := flag.String("slow-consumer-policy", "", "What to do with clients that cannot keep up: disconnect, drop_events or sample_events")
+	logFormatFlag := flag.String("log-format", "", "Log output format: text or json")
+	logLevelFlag := flag.String("log-level", "", "Minimum log level: debug, info, warn or error")
+	recordFlag := flag.Bool("record", false, "Record CDP traffic to JSONL files from startup")
+	tracingExporterFlag := flag.String("tracing-exporter", "", "Trace exporter: none, otlp-http, otlp-grpc, stdout or file")
+	allowLockModeOverrideFlag := flag.Bool("allow-lock-mode-override", false, "Allow clients to pick a lock mode with the lock_mode query parameter")
 
 	flag.Parse()
 
+	var setenvErr error
 	if *configPathFlag != "" {
-		if err := os.Setenv("CONFIG_PATH", *configPathFlag); err != nil {
-			log.Printf("Warning: failed to set CONFIG_PATH env var: %v", err)
-		}
+		setenvErr = os.Setenv("CONFIG_PATH", *configPathFlag)
+	}
+
+	cfg, loadErr := config.Load()
+	if loadErr != nil {
+		cfg = config.DefaultConfig()
 	}
 
-	log.Println("Starting Browsergrid CDP Proxy...")
+	if *logFormatFlag != "" {
+		cfg.LogFormat = *logFormatFlag
+	}
+
+	if *logLevelFlag != "" {
+		cfg.LogLevel = *logLevelFlag
+	}
+
+	if err := logging.Setup(os.Stderr, cfg.LogFormat, cfg.LogLevel); err != nil {
+		slog.Error("Failed to set up logging", "error", err)
+		os.Exit(1)
+	}
 
-	cfg := loadConfig()
+	slog.Info("Starting Browsergrid CDP Proxy...")
+
+	if setenvErr != nil {
+		slog.Warn("Failed to set CONFIG_PATH env var", "error", setenvErr)
+	}
+	if loadErr != nil {
+		slog.Warn("Failed to load config, using defaults", "error", loadErr)
+	}
 
 	if *portFlag != "" {
 		cfg.Port = *portFlag
@@ -50,24 +90,166 @@ func main() {
 		cfg.ConnectionTimeoutSeconds = *connectionTimeoutFlag
 	}
 
+	if *lockModeFlag != "" {
+		cfg.LockMode = *lockModeFlag
+	}
+
+	if *allowLockModeOverrideFlag {
+		cfg.AllowLockModeOverride = true
+	}
+
+	if *slowConsumerPolicyFlag != "" {
+		cfg.SlowConsumerPolicy = *slowConsumerPolicyFlag
+	}
+
+	if *recordFlag {
+		cfg.RecordingEnabled = true
+	}
+
+	if *tracingExporterFlag != "" {
+		cfg.TracingExporter = *tracingExporterFlag
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		Insecure:    cfg.TracingInsecure,
+		FilePath:    cfg.TracingFile,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
+	lockMode, err := browser.ParseLockMode(cfg.LockMode)
+	if err != nil {
+		fatal("Invalid lock mode", err)
+	}
+
+	slowConsumerPolicy, err := browser.ParseSlowConsumerPolicy(cfg.SlowConsumerPolicy)
+	if err != nil {
+		fatal("Invalid slow consumer policy", err)
+	}
+
+	giveUp, err := browser.ParseGiveUpAction(cfg.ReconnectGiveUp)
+	if err != nil {
+		fatal("Invalid reconnect give-up action", err)
+	}
+
+	var commandTimeouts map[string]time.Duration
+	if cfg.CommandTimeouts != nil {
+		commandTimeouts = make(map[string]time.Duration, len(cfg.CommandTimeouts))
+		for method, seconds := range cfg.CommandTimeouts {
+			commandTimeouts[method] = time.Duration(seconds) * time.Second
+		}
+	}
+
 	cdpProxyConfig := browser.CDPProxyConfig{
-		BrowserURL:        cfg.BrowserURL,
-		MaxMessageSize:    cfg.MaxMessageSize,
-		ConnectionTimeout: time.Duration(cfg.ConnectionTimeoutSeconds) * time.Second,
+		BrowserURL:             cfg.BrowserURL,
+		MaxMessageSize:         cfg.MaxMessageSize,
+		ConnectionTimeout:      time.Duration(cfg.ConnectionTimeoutSeconds) * time.Second,
+		LockMode:               lockMode,
+		AllowLockModeOverride:  cfg.AllowLockModeOverride,
+		ObserverAllowedMethods: cfg.ObserverAllowedMethods,
+		SlowConsumerPolicy:     slowConsumerPolicy,
+		SlowConsumerSampleRate: cfg.SlowConsumerSampleRate,
+		SampledEventMethods:    cfg.SampledEventMethods,
+		CommandQueueSize:       cfg.CommandQueueSize,
+		CommandQueueTimeout:    time.Duration(cfg.CommandQueueTimeoutSeconds) * time.Second,
+		CommandTimeout:         time.Duration(cfg.CommandTimeoutSeconds) * time.Second,
+		CommandTimeouts:        commandTimeouts,
+		Reconnect: browser.ReconnectPolicy{
+			InitialDelay: seconds(cfg.ReconnectInitialDelaySeconds),
+			MaxDelay:     seconds(cfg.ReconnectMaxDelaySeconds),
+			Multiplier:   cfg.ReconnectMultiplier,
+			Jitter:       cfg.ReconnectJitter,
+			MaxAttempts:  cfg.ReconnectMaxAttempts,
+			GiveUp:       giveUp,
+		},
+		KeepaliveInterval:  time.Duration(cfg.KeepaliveIntervalSeconds) * time.Second,
+		StallTimeout:       time.Duration(cfg.StallTimeoutSeconds) * time.Second,
+		ClientPingInterval: time.Duration(cfg.ClientPingIntervalSeconds) * time.Second,
+		ClientPongWait:     time.Duration(cfg.ClientPongWaitSeconds) * time.Second,
+		ClientWriteWait:    time.Duration(cfg.ClientWriteWaitSeconds) * time.Second,
 	}
 
 	dispatcher := browser.NewEventDispatcher()
 
-	cdpProxy, err := browser.NewCDPProxy(dispatcher, cdpProxyConfig)
+	// The top-level browser is the default, served on /devtools and /json.
+	// Without a browser_url the first configured browser takes its place.
+	var cdpProxies []*browser.CDPProxy
+	if cfg.BrowserURL != "" || len(cfg.Browsers) == 0 {
+		cdpProxy, err := browser.NewCDPProxy(dispatcher, cdpProxyConfig)
+		if err != nil {
+			fatal("Failed to create CDP Proxy", err)
+		}
+		cdpProxies = append(cdpProxies, cdpProxy)
+	}
+
+	for _, upstream := range cfg.Browsers {
+		proxyConfig, err := browserProxyConfig(cdpProxyConfig, upstream)
+		if err != nil {
+			fatal("Invalid browser config", err)
+		}
+
+		cdpProxy, err := browser.NewCDPProxy(dispatcher, proxyConfig)
+		if err != nil {
+			fatal("Failed to create CDP Proxy", err)
+		}
+		cdpProxies = append(cdpProxies, cdpProxy)
+	}
+	cdpProxy := cdpProxies[0]
+
+	recorder := recording.NewRecorder(recording.Config{
+		Dir:         cfg.RecordingDir,
+		MaxFileSize: cfg.RecordingMaxFileSize,
+		MaxFiles:    cfg.RecordingMaxFiles,
+	})
+	recorder.Subscribe(dispatcher)
+	for _, proxy := range cdpProxies {
+		proxy.SetRecorder(recorder)
+	}
+
+	if cfg.RecordingEnabled {
+		if err := recorder.Start(); err != nil {
+			fatal("Failed to start recording", err)
+		}
+		slog.Info("Recording CDP traffic", "dir", cfg.RecordingDir)
+	}
+
+	webhookConfigs := make([]webhook.Config, 0, len(cfg.Webhooks))
+	for _, hook := range cfg.Webhooks {
+		webhookConfigs = append(webhookConfigs, webhook.Config{
+			Name:          hook.Name,
+			URL:           hook.URL,
+			Secret:        hook.Secret,
+			Events:        hook.Events,
+			BatchSize:     hook.BatchSize,
+			FlushInterval: time.Duration(hook.FlushIntervalSeconds) * time.Second,
+			MaxQueue:      hook.MaxQueue,
+			MaxRetries:    hook.MaxRetries,
+			Timeout:       time.Duration(hook.TimeoutSeconds) * time.Second,
+		})
+	}
+
+	webhooks, err := webhook.NewManager(webhookConfigs)
 	if err != nil {
-		log.Fatalf("Failed to create CDP Proxy: %v", err)
+		fatal("Invalid webhook config", err)
 	}
+	webhooks.Start(dispatcher)
 
 	server := api.NewServer(cdpProxy, dispatcher, cfg.Port, cfg)
+	server.SetRecorder(recorder)
+	server.SetWebhooks(webhooks)
+	for _, proxy := range cdpProxies[1:] {
+		if err := server.AddBrowser(proxy); err != nil {
+			fatal("Invalid browser config", err)
+		}
+	}
 
 	go func() {
 		if err := server.Start(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			fatal("Failed to start server", err)
 		}
 	}()
 
@@ -75,27 +257,77 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	slog.Info("Shutting down server...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server shutdown failed: %v", err)
+		fatal("Server shutdown failed", err)
 	}
 
-	if err := cdpProxy.Shutdown(); err != nil {
-		log.Fatalf("CDP Proxy shutdown failed: %v", err)
+	for _, proxy := range cdpProxies {
+		if err := proxy.Shutdown(); err != nil {
+			fatal("CDP Proxy shutdown failed", err)
+		}
 	}
 
-	log.Println("Server gracefully stopped")
+	if err := webhooks.Stop(ctx); err != nil {
+		slog.Warn("Webhook shutdown failed", "error", err)
+	}
+
+	if recorder.Recording() {
+		if err := recorder.Stop(); err != nil {
+			slog.Warn("Failed to close recording", "error", err)
+		}
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("Tracing shutdown failed", "error", err)
+	}
+
+	slog.Info("Server gracefully stopped")
 }
 
-func loadConfig() *config.Config {
-	cfg, err := config.Load()
-	if err != nil {
-		log.Printf("Warning: Failed to load config, using defaults: %v", err)
-		return config.DefaultConfig()
+// fatal logs err at error level and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// browserProxyConfig applies the settings of an additional browser to the
+// top-level proxy config.
+func browserProxyConfig(base browser.CDPProxyConfig, upstream config.BrowserConfig) (browser.CDPProxyConfig, error) {
+	if upstream.Name == "" || strings.Contains(upstream.Name, "/") {
+		return base, fmt.Errorf("invalid browser name %q", upstream.Name)
 	}
-	return cfg
+	if upstream.BrowserURL == "" {
+		return base, fmt.Errorf("browser %q needs a browser_url", upstream.Name)
+	}
+
+	proxyConfig := base
+	proxyConfig.Name = upstream.Name
+	proxyConfig.BrowserURL = upstream.BrowserURL
+	if upstream.MaxMessageSize > 0 {
+		proxyConfig.MaxMessageSize = upstream.MaxMessageSize
+	}
+	if upstream.ConnectionTimeoutSeconds > 0 {
+		proxyConfig.ConnectionTimeout = time.Duration(upstream.ConnectionTimeoutSeconds) * time.Second
+	}
+	if upstream.LockMode != "" {
+		lockMode, err := browser.ParseLockMode(upstream.LockMode)
+		if err != nil {
+			return base, fmt.Errorf("browser %q: %w", upstream.Name, err)
+		}
+		proxyConfig.LockMode = lockMode
+	}
+	if upstream.CommandTimeoutSeconds > 0 {
+		proxyConfig.CommandTimeout = time.Duration(upstream.CommandTimeoutSeconds) * time.Second
+	}
+	return proxyConfig, nil
+}
+
+// seconds converts a fractional number of seconds from the config.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
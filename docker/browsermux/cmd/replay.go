@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"browsermux/internal/logging"
+	"browsermux/internal/replay"
+)
+
+// runReplay serves a recorded session as a mock browser:
+//
+//	browsermux replay --file session.jsonl [--port 9222]
+func runReplay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	fileFlag := flags.String("file", "", "JSONL recording to replay")
+	portFlag := flags.String("port", "9222", "Port to listen on")
+	logFormatFlag := flags.String("log-format", "text", "Log output format: text or json")
+	logLevelFlag := flags.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	flags.Parse(args)
+
+	if err := logging.Setup(os.Stderr, *logFormatFlag, *logLevelFlag); err != nil {
+		slog.Error("Failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+
+	if *fileFlag == "" {
+		slog.Error("replay needs --file")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	session, err := replay.LoadFile(*fileFlag)
+	if err != nil {
+		fatal("Failed to load recording", err)
+	}
+
+	slog.Info("Replaying recorded session", "file", *fileFlag, "commands", session.Len(), "addr", ":"+*portFlag)
+	if err := http.ListenAndServe(":"+*portFlag, replay.NewServer(session)); err != nil {
+		fatal("Replay server failed", err)
+	}
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/browser"
+	"browsermux/internal/logging"
+)
+
+const (
+	// eventBufferSize is how many events a slow stream subscriber may fall
+	// behind before events are dropped for it.
+	eventBufferSize = 256
+	sseKeepalive    = 15 * time.Second
+
+	paramFilterPrefix = "param."
+)
+
+// eventFilter selects the events a stream subscriber receives. Empty fields
+// match everything.
+type eventFilter struct {
+	types    []string
+	methods  []string
+	sourceID string
+	browser  string
+	params   map[string]interface{}
+}
+
+// parseEventFilter reads the filter from query parameters:
+//
+//	type=client.connected,cdp.*  event types, "*" suffix globs allowed
+//	method=Page.*                CDP methods, "*" suffix globs allowed
+//	source_id=<client id>        events of one client
+//	browser=<name>               events of one upstream browser
+//	param.frame.url=...          MatchesCDPFilter-style param match; values are
+//	                             JSON when they parse as JSON, strings otherwise
+func parseEventFilter(query url.Values) eventFilter {
+	filter := eventFilter{
+		types:    splitQueryList(query["type"]),
+		methods:  splitQueryList(query["method"]),
+		sourceID: query.Get("source_id"),
+		browser:  query.Get("browser"),
+	}
+
+	for key, values := range query {
+		field, ok := strings.CutPrefix(key, paramFilterPrefix)
+		if !ok || field == "" || len(values) == 0 {
+			continue
+		}
+		if filter.params == nil {
+			filter.params = make(map[string]interface{})
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(values[0]), &value); err != nil {
+			value = values[0]
+		}
+		filter.params[field] = value
+	}
+
+	return filter
+}
+
+func splitQueryList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+func (f eventFilter) matches(event browser.Event) bool {
+	if len(f.types) > 0 && !matchesAny(f.types, string(event.Type), matchTypePattern) {
+		return false
+	}
+	if len(f.methods) > 0 && !matchesAny(f.methods, event.Method, browser.MatchesMethod) {
+		return false
+	}
+	if f.sourceID != "" && f.sourceID != event.SourceID {
+		return false
+	}
+	if f.browser != "" && f.browser != eventBrowser(event) {
+		return false
+	}
+	return browser.MatchesCDPFilter(&browser.CDPMessage{Method: event.Method, Params: event.Params}, "*", f.params)
+}
+
+// eventBrowser returns the browser an event came from. Events of the default
+// browser are not stamped with its name.
+func eventBrowser(event browser.Event) string {
+	if event.Browser == "" {
+		return browser.DefaultBrowserName
+	}
+	return event.Browser
+}
+
+func matchesAny(patterns []string, value string, match func(pattern, value string) bool) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTypePattern(pattern, eventType string) bool {
+	return browser.MatchesEventType(pattern, browser.EventType(eventType))
+}
+
+// eventSubscriber is one open event stream. Events that do not fit in its
+// buffer are dropped.
+type eventSubscriber struct {
+	filter eventFilter
+	events chan browser.Event
+}
+
+// eventHub fans dispatcher events out to the open event streams. It is
+// registered with the dispatcher once, since handlers cannot be removed, and
+// synchronously, so streams see events in dispatch order.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+	closed      bool
+}
+
+func newEventHub(dispatcher browser.EventDispatcher) *eventHub {
+	hub := &eventHub{subscribers: make(map[*eventSubscriber]struct{})}
+	if dispatcher != nil {
+		dispatcher.RegisterSync("*", hub.publish)
+	}
+	return hub
+}
+
+func (h *eventHub) subscribe(filter eventFilter) *eventSubscriber {
+	sub := &eventSubscriber{filter: filter, events: make(chan browser.Event, eventBufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		close(sub.events)
+		return sub
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+func (h *eventHub) publish(event browser.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+		}
+	}
+}
+
+// close ends every open stream.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// handleEvents streams dispatcher events as Server-Sent Events, or over a
+// WebSocket when the request is an upgrade.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	filter := parseEventFilter(r.URL.Query())
+
+	if websocket.IsWebSocketUpgrade(r) {
+		s.streamEventsWebSocket(w, r, filter)
+		return
+	}
+	s.streamEventsSSE(w, r, filter)
+}
+
+func (s *Server) streamEventsSSE(w http.ResponseWriter, r *http.Request, filter eventFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := s.events.subscribe(filter)
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) streamEventsWebSocket(w http.ResponseWriter, r *http.Request, filter eventFilter) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("Error upgrading event stream to WebSocket", logging.KeyRemoteAddr, r.RemoteAddr, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := s.events.subscribe(filter)
+	defer s.events.unsubscribe(sub)
+
+	// The stream is one-way; reading only notices the peer going away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-sub.events:
+			if !ok {
+				closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				_ = conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/browser"
+	"browsermux/internal/config"
+)
+
+func TestEventFilter(t *testing.T) {
+	navigated := browser.Event{
+		Type:     browser.EventCDPEvent,
+		Method:   "Page.frameNavigated",
+		Params:   map[string]interface{}{"frame": map[string]interface{}{"url": "https://example.com", "depth": float64(0)}},
+		SourceID: "browser",
+	}
+	connected := browser.Event{Type: browser.EventClientConnected, SourceID: "a"}
+
+	tests := []struct {
+		query    string
+		expected []bool
+	}{
+		{"", []bool{true, true}},
+		{"type=client.connected", []bool{false, true}},
+		{"type=cdp.*,client.disconnected", []bool{true, false}},
+		{"method=Page.*", []bool{true, false}},
+		{"method=Network.*", []bool{false, false}},
+		{"method=Page.frameNavigated", []bool{true, false}},
+		{"method=Page.frame?avigated", []bool{false, false}},
+		{"source_id=a", []bool{false, true}},
+		{"browser=default", []bool{true, true}},
+		{"browser=chromium", []bool{false, false}},
+		{"param.frame.url=https://example.com", []bool{true, false}},
+		{"param.frame.depth=0", []bool{true, false}},
+		{"param.frame.url=https://other.example", []bool{false, false}},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		filter := parseEventFilter(query)
+		for i, event := range []browser.Event{navigated, connected} {
+			if got := filter.matches(event); got != tt.expected[i] {
+				t.Errorf("Filter %q on %s: got %v, want %v", tt.query, event.Type, got, tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestEventHubOrder(t *testing.T) {
+	dispatcher := browser.NewEventDispatcher()
+	hub := newEventHub(dispatcher)
+	sub := hub.subscribe(eventFilter{})
+	defer hub.unsubscribe(sub)
+
+	for i := 0; i < 100; i++ {
+		dispatcher.Dispatch(browser.Event{Type: browser.EventCDPEvent, SourceID: strconv.Itoa(i)})
+	}
+	for i := 0; i < 100; i++ {
+		if event := <-sub.events; event.SourceID != strconv.Itoa(i) {
+			t.Fatalf("Expected event %d, got %s", i, event.SourceID)
+		}
+	}
+}
+
+func TestEventStreamSSE(t *testing.T) {
+	dispatcher := browser.NewEventDispatcher()
+	server := NewServer(&browser.CDPProxy{}, dispatcher, "8080", &config.Config{Port: "8080"})
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+	defer server.events.close()
+
+	resp, err := http.Get(ts.URL + "/api/events?type=client.*")
+	if err != nil {
+		t.Fatalf("GET /api/events failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	dispatcher.Dispatch(browser.Event{Type: browser.EventCDPCommand, Method: "Page.reload"})
+	dispatcher.Dispatch(browser.Event{Type: browser.EventClientDisconnected, SourceID: "a"})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	select {
+	case line := <-lines:
+		if line != "event: client.disconnected" {
+			t.Errorf("Expected the client.disconnected event, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	}
+
+	select {
+	case line := <-lines:
+		if !strings.HasPrefix(line, "data: ") || !strings.Contains(line, `"source_id":"a"`) {
+			t.Errorf("Expected event data, got %q", line)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for event data")
+	}
+}
+
+func TestEventStreamWebSocket(t *testing.T) {
+	dispatcher := browser.NewEventDispatcher()
+	server := NewServer(&browser.CDPProxy{}, dispatcher, "8080", &config.Config{Port: "8080"})
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/api/events?method=Target.*", nil)
+	if err != nil {
+		t.Fatalf("Failed to dial event stream: %v", err)
+	}
+	defer conn.Close()
+
+	// The subscription is set up right after the upgrade.
+	deadline := time.Now().Add(time.Second)
+	for {
+		server.events.mu.Lock()
+		subscribed := len(server.events.subscribers) == 1
+		server.events.mu.Unlock()
+		if subscribed || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	dispatcher.Dispatch(browser.Event{Type: browser.EventCDPEvent, Method: "Page.loadEventFired"})
+	dispatcher.Dispatch(browser.Event{Type: browser.EventCDPEvent, Method: "Target.targetCreated"})
+
+	var event browser.Event
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatalf("Failed to read event: %v", err)
+	}
+	if event.Method != "Target.targetCreated" {
+		t.Errorf("Expected Target.targetCreated, got %s", event.Method)
+	}
+
+	server.events.close()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected the stream to close on shutdown, got %v", err)
+	}
+}
@@ -1,10 +1,12 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
 	"time"
+
+	"browsermux/internal/logging"
 )
 
 func Logging(next http.Handler) http.Handler {
@@ -13,12 +15,11 @@ func Logging(next http.Handler) http.Handler {
 
 		next.ServeHTTP(w, r)
 
-		log.Printf(
-			"%s %s %s %s",
-			r.RemoteAddr,
-			r.Method,
-			r.URL.Path,
-			time.Since(start),
+		slog.Info("HTTP request",
+			logging.KeyRemoteAddr, r.RemoteAddr,
+			"http_method", r.Method,
+			"path", r.URL.Path,
+			"duration", time.Since(start),
 		)
 	})
 }
@@ -27,7 +28,7 @@ func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("PANIC: %v\n%s", err, debug.Stack())
+				slog.Error("Recovered from panic", "panic", err, "path", r.URL.Path, "stack", string(debug.Stack()))
 
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 			}
@@ -14,6 +14,13 @@ import (
 )
 
 func NewCDPReverseProxy(browserBaseURL string) (*httputil.ReverseProxy, error) {
+	return newPrefixedCDPReverseProxy(browserBaseURL, "")
+}
+
+// newPrefixedCDPReverseProxy serves the browser's /json endpoints below
+// pathPrefix, as in /browsers/chrome/json/version, and points the WebSocket
+// URLs in its responses below pathPrefix too.
+func newPrefixedCDPReverseProxy(browserBaseURL, pathPrefix string) (*httputil.ReverseProxy, error) {
 	target, err := url.Parse(browserBaseURL)
 	if err != nil {
 		return nil, err
@@ -40,6 +47,10 @@ func NewCDPReverseProxy(browserBaseURL string) (*httputil.ReverseProxy, error) {
 		r.URL.Scheme = target.Scheme
 		r.URL.Host = target.Host
 		r.Host = target.Host
+		if pathPrefix != "" {
+			r.URL.Path = strings.TrimPrefix(r.URL.Path, pathPrefix)
+			r.URL.RawPath = ""
+		}
 	}
 
 	proxy.ModifyResponse = func(resp *http.Response) error {
@@ -69,7 +80,7 @@ func NewCDPReverseProxy(browserBaseURL string) (*httputil.ReverseProxy, error) {
 		}
 		_ = resp.Body.Close()
 
-		rewritten, err := rewriteCDPJSON(body, extScheme, extHost, internalPort)
+		rewritten, err := rewriteCDPJSON(body, extScheme, extHost, internalPort, pathPrefix)
 		if err != nil {
 			rewritten = body
 		}
@@ -116,7 +127,7 @@ func firstNonEmpty(values ...string) string {
 	return ""
 }
 
-func rewriteCDPJSON(body []byte, extScheme, extHost, internalPort string) ([]byte, error) {
+func rewriteCDPJSON(body []byte, extScheme, extHost, internalPort, pathPrefix string) ([]byte, error) {
 	var any interface{}
 	if err := json.Unmarshal(body, &any); err != nil {
 		return nil, err
@@ -124,11 +135,11 @@ func rewriteCDPJSON(body []byte, extScheme, extHost, internalPort string) ([]byt
 
 	switch v := any.(type) {
 	case map[string]interface{}:
-		rewriteCDPObject(v, extScheme, extHost)
+		rewriteCDPObject(v, extScheme, extHost, pathPrefix)
 	case []interface{}:
 		for _, item := range v {
 			if m, ok := item.(map[string]interface{}); ok {
-				rewriteCDPObject(m, extScheme, extHost)
+				rewriteCDPObject(m, extScheme, extHost, pathPrefix)
 			}
 		}
 	default:
@@ -142,7 +153,7 @@ func rewriteCDPJSON(body []byte, extScheme, extHost, internalPort string) ([]byt
 	return out, nil
 }
 
-func rewriteCDPObject(m map[string]interface{}, extScheme, extHost string) {
+func rewriteCDPObject(m map[string]interface{}, extScheme, extHost, pathPrefix string) {
 	var wsPath string
 	if raw, ok := m["webSocketDebuggerUrl"].(string); ok && raw != "" {
 		if u, err := url.Parse(raw); err == nil {
@@ -167,7 +178,7 @@ func rewriteCDPObject(m map[string]interface{}, extScheme, extHost string) {
 	}
 
 	if wsPath != "" {
-		wsURL := wsScheme + "://" + extHost + wsPath
+		wsURL := wsScheme + "://" + extHost + pathPrefix + wsPath
 		m["webSocketDebuggerUrl"] = wsURL
 		m["devtoolsFrontendUrl"] = wsURL
 		if _, ok := m["devtoolsFrontendUrlCompat"]; ok {
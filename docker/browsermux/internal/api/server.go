@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -16,8 +19,30 @@ import (
 	"browsermux/internal/api/middleware"
 	"browsermux/internal/browser"
 	"browsermux/internal/config"
+	"browsermux/internal/logging"
+	"browsermux/internal/metrics"
+	"browsermux/internal/recording"
+	"browsermux/internal/webhook"
 )
 
+// roleHeader lets an authenticating gateway in front of browsermux force a
+// connection into the observer role.
+const roleHeader = "X-Browsermux-Role"
+
+// requesterHeader names the operator or service behind an administrative
+// request. The remote address is recorded when it is missing.
+const requesterHeader = "X-Browsermux-Requester"
+
+// metadataSelectorPrefix marks the query parameters that select clients by
+// metadata, as in metadata.user_agent=...
+const metadataSelectorPrefix = "metadata."
+
+// browserPathPrefix precedes the name of a browser in its routes.
+const browserPathPrefix = "/browsers/"
+
+// defaultReadinessTimeout bounds the Browser.getVersion round trip of /readyz.
+const defaultReadinessTimeout = 2 * time.Second
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
@@ -33,6 +58,19 @@ type Server struct {
 	eventDispatcher browser.EventDispatcher
 	browserBaseURL  string
 	config          *config.Config
+	recorder        *recording.Recorder
+	events          *eventHub
+	webhooks        *webhook.Manager
+	// browsers are served below /browsers/{name}, in the order they were
+	// added. The default browser is one of them.
+	browsers     map[string]*upstreamBrowser
+	browserNames []string
+}
+
+// upstreamBrowser is a browser served below /browsers/{name}.
+type upstreamBrowser struct {
+	proxy *browser.CDPProxy
+	json  http.Handler
 }
 
 func NewServer(cdpProxy *browser.CDPProxy, eventDispatcher browser.EventDispatcher, port string, cfg *config.Config) *Server {
@@ -46,6 +84,7 @@ func NewServer(cdpProxy *browser.CDPProxy, eventDispatcher browser.EventDispatch
 		eventDispatcher: eventDispatcher,
 		browserBaseURL:  browserBaseURL,
 		config:          cfg,
+		events:          newEventHub(eventDispatcher),
 		server: &http.Server{
 			Addr:    ":" + port,
 			Handler: router,
@@ -53,16 +92,52 @@ func NewServer(cdpProxy *browser.CDPProxy, eventDispatcher browser.EventDispatch
 	}
 
 	server.setupRoutes()
+	if err := server.AddBrowser(cdpProxy); err != nil {
+		slog.Error("Failed to add default browser", "error", err)
+		os.Exit(1)
+	}
 	return server
 }
 
+// AddBrowser serves proxy below /browsers/{name}/devtools/ and
+// /browsers/{name}/json, where name is proxy.Name().
+func (s *Server) AddBrowser(proxy *browser.CDPProxy) error {
+	name := proxy.Name()
+	if _, exists := s.browsers[name]; exists {
+		return fmt.Errorf("browser %q already added", name)
+	}
+
+	jsonProxy, err := newPrefixedCDPReverseProxy(normalizeBrowserURL(proxy.GetConfig().BrowserURL), browserPathPrefix+name)
+	if err != nil {
+		return fmt.Errorf("browser %q: %w", name, err)
+	}
+
+	if s.browsers == nil {
+		s.browsers = make(map[string]*upstreamBrowser)
+	}
+	s.browsers[name] = &upstreamBrowser{proxy: proxy, json: jsonProxy}
+	metrics.RegisterBrowser(name)
+	s.browserNames = append(s.browserNames, name)
+	return nil
+}
+
+// SetRecorder enables the /api/recording endpoints.
+func (s *Server) SetRecorder(recorder *recording.Recorder) {
+	s.recorder = recorder
+}
+
+// SetWebhooks reports the sinks of manager on /api/webhooks.
+func (s *Server) SetWebhooks(manager *webhook.Manager) {
+	s.webhooks = manager
+}
+
 func (s *Server) Start() error {
-	log.Printf("Starting API server on %s", s.server.Addr)
-	log.Printf("Proxying browser at %s", s.browserBaseURL)
+	slog.Info("Starting API server", "addr", s.server.Addr, "browser_url", s.browserBaseURL)
 	return s.server.ListenAndServe()
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.events.close()
 	return s.server.Shutdown(ctx)
 }
 
@@ -72,15 +147,43 @@ func (s *Server) setupRoutes() {
 
 	cdpProxy, err := NewCDPReverseProxy(s.browserBaseURL)
 	if err != nil {
-		log.Fatalf("Failed to create CDP reverse proxy: %v", err)
+		slog.Error("Failed to create CDP reverse proxy", "error", err)
+		os.Exit(1)
 	}
 
 	s.router.PathPrefix("/json").Handler(cdpProxy)
 
 	s.router.HandleFunc("/devtools/{path:.*}", s.handleWebSocket)
 
+	s.router.PathPrefix(browserPathPrefix + "{name}/json").HandlerFunc(s.handleBrowserJSON)
+	s.router.HandleFunc(browserPathPrefix+"{name}/devtools/{path:.*}", s.handleBrowserWebSocket)
+
 	s.router.HandleFunc("/api/browser", s.handleBrowserInfo).Methods("GET")
+	s.router.HandleFunc("/api/browsers", s.handleBrowsers).Methods("GET")
 	s.router.HandleFunc("/api/clients", s.handleClients).Methods("GET")
+	s.router.HandleFunc("/api/clients", s.handleEvictClients).Methods("DELETE")
+	s.router.HandleFunc("/api/clients/{id}", s.handleClient).Methods("GET")
+	s.router.HandleFunc("/api/clients/{id}", s.handleEvictClient).Methods("DELETE")
+	s.router.HandleFunc("/api/clients/{id}/trace", s.handleClientTrace(true)).Methods("PUT")
+	s.router.HandleFunc("/api/clients/{id}/trace", s.handleClientTrace(false)).Methods("DELETE")
+
+	s.router.HandleFunc("/api/session/lock", s.handleGetLock).Methods("GET")
+	s.router.HandleFunc("/api/session/lock", s.handleRevokeLock).Methods("DELETE")
+	s.router.HandleFunc("/api/session/lock/transfer", s.handleTransferLock).Methods("POST")
+
+	s.router.HandleFunc("/api/events", s.handleEvents).Methods("GET")
+
+	s.router.HandleFunc("/api/webhooks", s.handleWebhooks).Methods("GET")
+
+	s.router.HandleFunc("/api/recording", s.handleRecordingStatus).Methods("GET")
+	s.router.HandleFunc("/api/recording/start", s.handleRecordingStart).Methods("POST")
+	s.router.HandleFunc("/api/recording/stop", s.handleRecordingStop).Methods("POST")
+	s.router.HandleFunc("/api/recording/files/{name}", s.handleRecordingDownload).Methods("GET")
+
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	s.router.HandleFunc("/livez", s.handleLivez).Methods("GET")
+	s.router.HandleFunc("/readyz", s.handleReadyz).Methods("GET")
 
 	s.router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -89,9 +192,32 @@ func (s *Server) setupRoutes() {
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	s.serveWebSocket(w, r, s.cdpProxy)
+}
+
+func (s *Server) handleBrowserWebSocket(w http.ResponseWriter, r *http.Request) {
+	upstream, ok := s.browsers[mux.Vars(r)["name"]]
+	if !ok {
+		http.Error(w, "Unknown browser", http.StatusNotFound)
+		return
+	}
+	s.serveWebSocket(w, r, upstream.proxy)
+}
+
+func (s *Server) handleBrowserJSON(w http.ResponseWriter, r *http.Request) {
+	upstream, ok := s.browsers[mux.Vars(r)["name"]]
+	if !ok {
+		http.Error(w, "Unknown browser", http.StatusNotFound)
+		return
+	}
+	upstream.json.ServeHTTP(w, r)
+}
+
+// serveWebSocket connects a client to the browser behind cdpProxy.
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request, cdpProxy *browser.CDPProxy) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("Error upgrading connection to WebSocket: %v", err)
+		slog.Warn("Error upgrading connection to WebSocket", logging.KeyRemoteAddr, r.RemoteAddr, "error", err)
 		return
 	}
 
@@ -101,6 +227,8 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	metadata := extractClientMetadata(r)
 	metadata["path"] = path
 
+	// Only the page route binds a client to a target.
+	delete(metadata, "target_id")
 	if strings.HasPrefix(path, "page/") {
 		parts := strings.Split(path, "/")
 		if len(parts) > 1 {
@@ -108,43 +236,192 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	clientID, err := s.cdpProxy.AddClient(conn, metadata)
+	clientID, err := cdpProxy.AddClient(conn, metadata)
 	if err != nil {
 		if errors.Is(err, browser.ErrSessionLocked) {
-			log.Printf("Rejecting client connection: session already locked by another client")
+			slog.Info("Rejecting client connection: session already locked by another client", logging.KeyRemoteAddr, r.RemoteAddr)
 			closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session already locked by another client")
 			_ = conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		} else if errors.Is(err, browser.ErrLockModeOverrideDenied) || errors.Is(err, browser.ErrInvalidLockMode) {
+			slog.Info("Rejecting client connection", logging.KeyRemoteAddr, r.RemoteAddr, "error", err)
+			closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error())
+			_ = conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
 		} else {
-			log.Printf("Error adding client: %v", err)
+			slog.Error("Error adding client", logging.KeyRemoteAddr, r.RemoteAddr, "error", err)
 		}
 		conn.Close()
 		return
 	}
 
-	log.Printf("Client %s connected with path %s", clientID, path)
+	slog.Info("Client connected", logging.KeyClientID, clientID, logging.KeyRemoteAddr, r.RemoteAddr, "path", path, "browser", cdpProxy.Name())
+}
+
+// browserProxy returns the proxy named by the browser query parameter, or
+// the default proxy without one. It answers 404 for an unknown name.
+func (s *Server) browserProxy(w http.ResponseWriter, r *http.Request) (*browser.CDPProxy, bool) {
+	name := r.URL.Query().Get("browser")
+	if name == "" {
+		return s.cdpProxy, true
+	}
+
+	upstream, ok := s.browsers[name]
+	if !ok {
+		http.Error(w, "Unknown browser", http.StatusNotFound)
+		return nil, false
+	}
+	return upstream.proxy, true
 }
 
 func (s *Server) handleBrowserInfo(w http.ResponseWriter, r *http.Request) {
-	info, err := s.cdpProxy.GetInfo()
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get browser info: %v", err), http.StatusInternalServerError)
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
 		return
 	}
 
 	data := map[string]interface{}{
-		"browser": info,
-		"clients": s.cdpProxy.GetClientCount(),
-		"status":  s.cdpProxy.IsConnected(),
+		"clients": cdpProxy.GetClientCount(),
+		"status":  cdpProxy.IsConnected(),
+		"state":   cdpProxy.State(),
+	}
+
+	// The connection state is reported even while the browser is unreachable.
+	status := http.StatusOK
+	info, err := cdpProxy.GetInfo()
+	if err != nil {
+		data["error"] = fmt.Sprintf("Failed to get browser info: %v", err)
+		status = http.StatusServiceUnavailable
+	} else {
+		data["browser"] = info
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := writeJSON(w, data); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+// browserStatus is an entry of /api/browsers.
+type browserStatus struct {
+	Name       string         `json:"name"`
+	Default    bool           `json:"default"`
+	BrowserURL string         `json:"browser_url"`
+	Clients    int            `json:"clients"`
+	Health     browser.Health `json:"health"`
+}
+
+func (s *Server) handleBrowsers(w http.ResponseWriter, r *http.Request) {
+	browsers := make([]browserStatus, 0, len(s.browserNames))
+	for _, name := range s.browserNames {
+		proxy := s.browsers[name].proxy
+		browsers = append(browsers, browserStatus{
+			Name:       name,
+			Default:    proxy == s.cdpProxy,
+			BrowserURL: proxy.GetConfig().BrowserURL,
+			Clients:    proxy.GetClientCount(),
+			Health:     proxy.Health(),
+		})
+	}
+
+	data := map[string]interface{}{
+		"browsers": browsers,
+		"count":    len(browsers),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := writeJSON(w, data); err != nil {
-		log.Printf("Error writing JSON response: %v", err)
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+// handleLivez reports that the server is up and serving requests. It does not
+// depend on the browser, which reconnects on its own.
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, map[string]string{"status": "ok"}); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
 	}
 }
 
+// browserReadiness is an entry of the browsers list of /readyz.
+type browserReadiness struct {
+	Name    string         `json:"name"`
+	Default bool           `json:"default"`
+	Ready   bool           `json:"ready"`
+	Error   string         `json:"error,omitempty"`
+	Health  browser.Health `json:"health"`
+}
+
+// handleReadyz reports ready while the default browser is connected and
+// answers Browser.getVersion within the readiness timeout. The browsers are
+// probed concurrently. Other browsers that are not ready only degrade the
+// status, so that they do not take the healthy ones out of rotation. error
+// names the default browser if it is not ready, else the first one that is
+// not.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.readinessTimeout())
+	defer cancel()
+
+	browsers := make([]browserReadiness, len(s.browserNames))
+	var wg sync.WaitGroup
+	for i, name := range s.browserNames {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+
+			proxy := s.browsers[name].proxy
+			readiness := browserReadiness{Name: name, Default: proxy == s.cdpProxy, Ready: true}
+			if _, err := proxy.Ping(ctx); err != nil {
+				readiness.Ready = false
+				readiness.Error = err.Error()
+			}
+			readiness.Health = proxy.Health()
+			browsers[i] = readiness
+		}(i, name)
+	}
+	wg.Wait()
+
+	data := map[string]interface{}{
+		"status":   "ready",
+		"browser":  s.cdpProxy.Health(),
+		"browsers": browsers,
+	}
+	status := http.StatusOK
+	for _, readiness := range browsers {
+		if readiness.Ready {
+			continue
+		}
+		if _, failed := data["error"]; !failed {
+			data["status"] = "degraded"
+			data["error"] = fmt.Sprintf("browser %s: %s", readiness.Name, readiness.Error)
+		}
+		if readiness.Default {
+			data["status"] = "not_ready"
+			data["error"] = fmt.Sprintf("browser %s: %s", readiness.Name, readiness.Error)
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := writeJSON(w, data); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) readinessTimeout() time.Duration {
+	if s.config == nil || s.config.ReadinessTimeoutSeconds <= 0 {
+		return defaultReadinessTimeout
+	}
+	return time.Duration(s.config.ReadinessTimeoutSeconds) * time.Second
+}
+
 func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
-	clients := s.cdpProxy.GetClients()
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
+		return
+	}
+	clients := cdpProxy.GetClients()
 
 	data := map[string]interface{}{
 		"clients": clients,
@@ -153,7 +430,332 @@ func (s *Server) handleClients(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := writeJSON(w, data); err != nil {
-		log.Printf("Error writing JSON response: %v", err)
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) handleClient(w http.ResponseWriter, r *http.Request) {
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := cdpProxy.GetClient(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), clientErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, client); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+// handleEvictClient disconnects one client. The optional code and reason
+// query parameters are sent in the close frame.
+func (s *Server) handleEvictClient(w http.ResponseWriter, r *http.Request) {
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
+		return
+	}
+
+	code, reason, err := closeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clientID := mux.Vars(r)["id"]
+	if err := cdpProxy.EvictClient(clientID, code, reason, requester(r)); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to evict client: %v", err), clientErrorStatus(err))
+		return
+	}
+
+	s.writeEvicted(w, r, []string{clientID})
+}
+
+// handleEvictClients disconnects every client whose metadata matches the
+// metadata.<key>=<value> query parameters.
+func (s *Server) handleEvictClients(w http.ResponseWriter, r *http.Request) {
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
+		return
+	}
+
+	code, reason, err := closeParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	selector := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		if field, ok := strings.CutPrefix(key, metadataSelectorPrefix); ok && field != "" && len(values) > 0 {
+			selector[field] = values[0]
+		}
+	}
+	if len(selector) == 0 {
+		http.Error(w, "At least one metadata.<key>=<value> selector is required", http.StatusBadRequest)
+		return
+	}
+
+	evicted, err := cdpProxy.EvictClients(selector, code, reason, requester(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to evict clients: %v", err), clientErrorStatus(err))
+		return
+	}
+
+	s.writeEvicted(w, r, evicted)
+}
+
+func (s *Server) writeEvicted(w http.ResponseWriter, r *http.Request, evicted []string) {
+	data := map[string]interface{}{
+		"evicted": evicted,
+		"count":   len(evicted),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, data); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+// closeParams reads the close code and reason of an eviction.
+func closeParams(r *http.Request) (int, string, error) {
+	query := r.URL.Query()
+
+	code := websocket.CloseNormalClosure
+	if value := query.Get("code"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || !browser.ValidCloseCode(parsed) {
+			return 0, "", fmt.Errorf("invalid close code %q", value)
+		}
+		code = parsed
+	}
+
+	// Close frames carry at most 123 bytes of reason.
+	reason := query.Get("reason")
+	if len(reason) > 123 {
+		return 0, "", errors.New("close reason must be at most 123 bytes")
+	}
+	return code, reason, nil
+}
+
+func requester(r *http.Request) string {
+	if name := r.Header.Get(requesterHeader); name != "" {
+		return name
+	}
+	return r.RemoteAddr
+}
+
+// handleClientTrace turns full protocol logging for a single client on or off.
+func (s *Server) handleClientTrace(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cdpProxy, ok := s.browserProxy(w, r)
+		if !ok {
+			return
+		}
+
+		clientID := mux.Vars(r)["id"]
+		if err := cdpProxy.SetClientTrace(clientID, enabled); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to set protocol trace: %v", err), clientErrorStatus(err))
+			return
+		}
+
+		data := map[string]interface{}{
+			"client_id":      clientID,
+			"protocol_trace": enabled,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := writeJSON(w, data); err != nil {
+			slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+		}
+	}
+}
+
+func (s *Server) handleGetLock(w http.ResponseWriter, r *http.Request) {
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, cdpProxy.GetLock()); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) handleTransferLock(w http.ResponseWriter, r *http.Request) {
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ClientID string `json:"client_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ClientID == "" {
+		http.Error(w, "Request body must contain client_id", http.StatusBadRequest)
+		return
+	}
+
+	info, err := cdpProxy.TransferLock(req.ClientID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to transfer session lock: %v", err), lockErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, info); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) handleRevokeLock(w http.ResponseWriter, r *http.Request) {
+	cdpProxy, ok := s.browserProxy(w, r)
+	if !ok {
+		return
+	}
+
+	disconnect := r.URL.Query().Get("disconnect") == "true"
+
+	info, err := cdpProxy.RevokeLock(disconnect)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to revoke session lock: %v", err), lockErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, info); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	statuses := []webhook.Status{}
+	if s.webhooks != nil {
+		statuses = s.webhooks.Status()
+	}
+
+	data := map[string]interface{}{
+		"webhooks": statuses,
+		"count":    len(statuses),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, data); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) handleRecordingStatus(w http.ResponseWriter, r *http.Request) {
+	if s.recorder == nil {
+		http.Error(w, "Recording is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	s.writeRecordingStatus(w, r)
+}
+
+func (s *Server) handleRecordingStart(w http.ResponseWriter, r *http.Request) {
+	if s.recorder == nil {
+		http.Error(w, "Recording is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := s.recorder.Start(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start recording: %v", err), recordingErrorStatus(err))
+		return
+	}
+	slog.Info("Recording started", logging.KeyRemoteAddr, r.RemoteAddr)
+
+	s.writeRecordingStatus(w, r)
+}
+
+func (s *Server) handleRecordingStop(w http.ResponseWriter, r *http.Request) {
+	if s.recorder == nil {
+		http.Error(w, "Recording is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := s.recorder.Stop(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to stop recording: %v", err), recordingErrorStatus(err))
+		return
+	}
+	slog.Info("Recording stopped", logging.KeyRemoteAddr, r.RemoteAddr)
+
+	s.writeRecordingStatus(w, r)
+}
+
+func (s *Server) handleRecordingDownload(w http.ResponseWriter, r *http.Request) {
+	if s.recorder == nil {
+		http.Error(w, "Recording is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	file, err := s.recorder.Open(name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open recording: %v", err), recordingErrorStatus(err))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to open recording: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+func (s *Server) writeRecordingStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.recorder.Status()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list recordings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := writeJSON(w, status); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func recordingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, recording.ErrFileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, recording.ErrAlreadyRecording), errors.Is(err, recording.ErrNotRecording):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func clientErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, browser.ErrClientNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, browser.ErrInvalidCloseCode):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func lockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, browser.ErrClientNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, browser.ErrNoLockHolder), errors.Is(err, browser.ErrLockNotSupported):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
@@ -186,6 +788,17 @@ func extractClientMetadata(r *http.Request) map[string]interface{} {
 		}
 	}
 
+	// W3C trace context headers win over the query parameters of the same name.
+	for _, key := range []string{"traceparent", "tracestate"} {
+		if value := r.Header.Get(key); value != "" {
+			metadata[key] = value
+		}
+	}
+
+	if strings.EqualFold(r.Header.Get(roleHeader), string(browser.ClientRoleObserver)) {
+		metadata["role"] = string(browser.ClientRoleObserver)
+	}
+
 	return metadata
 }
 
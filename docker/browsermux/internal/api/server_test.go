@@ -1,12 +1,19 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 
 	"browsermux/internal/browser"
 	"browsermux/internal/config"
+	"browsermux/internal/recording"
+	"browsermux/internal/webhook"
 )
 
 func TestServerHealthCheck(t *testing.T) {
@@ -89,3 +96,497 @@ func TestNormalizeBrowserURL(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractClientMetadataObserverHeader(t *testing.T) {
+	req, err := http.NewRequest("GET", "/devtools/browser?role=controller", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Browsermux-Role", "observer")
+
+	metadata := extractClientMetadata(req)
+
+	if metadata["role"] != "observer" {
+		t.Errorf("Expected gateway header to force observer role, got %v", metadata["role"])
+	}
+}
+
+func TestSessionLockEndpoints(t *testing.T) {
+	proxy := &browser.CDPProxy{}
+	server := NewServer(proxy, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	t.Run("GET reports an unlocked session", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/session/lock", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), `"locked":false`) {
+			t.Errorf("Expected unlocked session, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("DELETE without holder conflicts", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("DELETE", "/api/session/lock", nil))
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("Expected 409, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Transfer to unknown client", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		body := strings.NewReader(`{"client_id":"missing"}`)
+		server.router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/session/lock/transfer", body))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rr.Code)
+		}
+	})
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rr.Code)
+	}
+	for _, name := range []string{"browsermux_browser_connected", "browsermux_inflight_commands", "go_goroutines"} {
+		if !strings.Contains(rr.Body.String(), name) {
+			t.Errorf("Expected %s in metrics output", name)
+		}
+	}
+}
+
+func TestClientTraceEndpointUnknownClient(t *testing.T) {
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	for _, method := range []string{"PUT", "DELETE"} {
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest(method, "/api/clients/missing/trace", nil))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", method, rr.Code)
+		}
+	}
+}
+
+func TestRecordingEndpoints(t *testing.T) {
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recording/start", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503 without a recorder, got %d", rr.Code)
+	}
+
+	recorder := recording.NewRecorder(recording.Config{Dir: t.TempDir()})
+	server.SetRecorder(recorder)
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recording/start", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"recording":true`) {
+		t.Fatalf("Expected recording to start, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	recorder.RecordMessage("client_to_browser", "a", []byte(`{"id":1,"method":"Browser.getVersion"}`))
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recording/stop", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected recording to stop, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("POST", "/api/recording/stop", nil))
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 when not recording, got %d", rr.Code)
+	}
+
+	status, err := recorder.Status()
+	if err != nil || len(status.Files) != 1 {
+		t.Fatalf("Expected one recording file, got %+v, %v", status, err)
+	}
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recording/files/"+status.Files[0].Name, nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Browser.getVersion") {
+		t.Errorf("Expected recording download, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/recording/files/browsermux-missing.jsonl", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown file, got %d", rr.Code)
+	}
+}
+
+func TestWebhooksEndpoint(t *testing.T) {
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/webhooks", nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"count":0`) {
+		t.Fatalf("Expected an empty webhook list, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	manager, err := webhook.NewManager([]webhook.Config{{Name: "control-plane", URL: "http://127.0.0.1:0/hook", Secret: "s3cret"}})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	server.SetWebhooks(manager)
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/webhooks", nil))
+	if !strings.Contains(rr.Body.String(), `"name":"control-plane"`) {
+		t.Errorf("Expected the webhook in the status, got %s", rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "s3cret") {
+		t.Error("Webhook secret must not be exposed")
+	}
+}
+
+func TestClientEndpointUnknownClient(t *testing.T) {
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/clients/missing", nil))
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", rr.Code)
+	}
+}
+
+func TestEvictEndpoints(t *testing.T) {
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	tests := []struct {
+		target   string
+		expected int
+	}{
+		{"/api/clients/missing", http.StatusNotFound},
+		{"/api/clients/missing?code=1005", http.StatusBadRequest},
+		{"/api/clients/missing?code=abc", http.StatusBadRequest},
+		{"/api/clients", http.StatusBadRequest},
+		{"/api/clients?metadata.tag=run-1", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("DELETE", tt.target, nil))
+
+		if rr.Code != tt.expected {
+			t.Errorf("DELETE %s: expected %d, got %d", tt.target, tt.expected, rr.Code)
+		}
+	}
+}
+
+func TestProbeEndpoints(t *testing.T) {
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/livez", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected /livez to return 200, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to return 503 without a browser, got %d", rr.Code)
+	}
+
+	var body struct {
+		Status  string         `json:"status"`
+		Error   string         `json:"error"`
+		Browser browser.Health `json:"browser"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid /readyz response: %v", err)
+	}
+	if body.Status != "not_ready" || body.Error == "" || body.Browser.Connected {
+		t.Errorf("Unexpected /readyz response %+v", body)
+	}
+}
+
+func TestBrowserRoutes(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Browser":"Chromium","webSocketDebuggerUrl":"ws://localhost:9222/devtools/browser/abc"}`))
+	}))
+	defer backend.Close()
+
+	server := NewServer(&browser.CDPProxy{}, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+
+	chromium, err := browser.NewCDPProxy(browser.NewEventDispatcher(), browser.CDPProxyConfig{Name: "chromium", BrowserURL: backend.URL})
+	if err != nil {
+		t.Fatalf("NewCDPProxy failed: %v", err)
+	}
+	defer chromium.Shutdown()
+
+	if err := server.AddBrowser(chromium); err != nil {
+		t.Fatalf("AddBrowser failed: %v", err)
+	}
+	if err := server.AddBrowser(chromium); err == nil {
+		t.Error("Expected an error for a browser name that is taken")
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/browsers/chromium/json/version", nil)
+	req.Host = "proxy:8080"
+	server.router.ServeHTTP(rr, req)
+	if expected := "ws://proxy:8080/browsers/chromium/devtools/browser/abc"; !strings.Contains(rr.Body.String(), expected) {
+		t.Errorf("Expected %s in the response, got %d %s", expected, rr.Code, rr.Body.String())
+	}
+
+	for _, target := range []string{"/browsers/firefox/json/version", "/browsers/firefox/devtools/browser"} {
+		rr = httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("GET %s: expected 404, got %d", target, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/browsers", nil))
+
+	var body struct {
+		Browsers []browserStatus `json:"browsers"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Invalid /api/browsers response: %v", err)
+	}
+	if len(body.Browsers) != 2 || body.Browsers[0].Name != "default" || !body.Browsers[0].Default || body.Browsers[1].Name != "chromium" || body.Browsers[1].Default {
+		t.Errorf("Unexpected browsers %+v", body.Browsers)
+	}
+}
+
+// newFakeBrowser serves /json/version and a CDP endpoint that answers every
+// command with an empty result.
+func newFakeBrowser(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	var fake *httptest.Server
+	fake = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json/version" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"Browser":              "Chromium",
+				"webSocketDebuggerUrl": "ws" + strings.TrimPrefix(fake.URL, "http") + "/devtools/browser/fake",
+			})
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg browser.CDPMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if err := conn.WriteJSON(map[string]interface{}{"id": msg.ID, "result": map[string]interface{}{}, "sessionId": msg.SessionID}); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// newConnectedProxy returns a proxy named name that is connected to a fake
+// browser.
+func newConnectedProxy(t *testing.T, name string) *browser.CDPProxy {
+	t.Helper()
+
+	cfg := browser.DefaultConfig()
+	cfg.Name = name
+	cfg.BrowserURL = newFakeBrowser(t).URL
+	proxy, err := browser.NewCDPProxy(browser.NewEventDispatcher(), cfg)
+	if err != nil {
+		t.Fatalf("NewCDPProxy failed: %v", err)
+	}
+	t.Cleanup(func() { proxy.Shutdown() })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !proxy.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out connecting %s to the fake browser", proxy.Name())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return proxy
+}
+
+func TestBrowserAdminEndpoints(t *testing.T) {
+	server := NewServer(newConnectedProxy(t, ""), browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+	if err := server.AddBrowser(newConnectedProxy(t, "chromium")); err != nil {
+		t.Fatalf("AddBrowser failed: %v", err)
+	}
+
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/browsers/chromium/devtools/browser/fake", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	clients := func(query string) (int, []*browser.ClientDTO) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/api/clients"+query, nil))
+		var body struct {
+			Clients []*browser.ClientDTO `json:"clients"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body.Clients
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var listed []*browser.ClientDTO
+	for len(listed) == 0 && time.Now().Before(deadline) {
+		_, listed = clients("?browser=chromium")
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(listed) != 1 {
+		t.Fatalf("Expected the client in /api/clients?browser=chromium, got %d", len(listed))
+	}
+	clientID := listed[0].ID
+
+	if code, defaults := clients(""); code != http.StatusOK || len(defaults) != 0 {
+		t.Errorf("Expected no clients on the default browser, got %d %d", code, len(defaults))
+	}
+	if code, _ := clients("?browser=firefox"); code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown browser, got %d", code)
+	}
+
+	for _, tc := range []struct {
+		method, target string
+		expected       int
+	}{
+		{"GET", "/api/browser?browser=chromium", http.StatusOK},
+		{"GET", "/api/clients/" + clientID + "?browser=chromium", http.StatusOK},
+		{"GET", "/api/clients/" + clientID, http.StatusNotFound},
+		{"PUT", "/api/clients/" + clientID + "/trace?browser=chromium", http.StatusOK},
+		{"GET", "/api/session/lock?browser=chromium", http.StatusOK},
+		{"GET", "/api/session/lock?browser=firefox", http.StatusNotFound},
+		{"DELETE", "/api/session/lock?browser=chromium", http.StatusOK},
+		{"DELETE", "/api/clients/" + clientID + "?browser=chromium", http.StatusOK},
+	} {
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.target, nil))
+		if rr.Code != tc.expected {
+			t.Errorf("%s %s: expected %d, got %d %s", tc.method, tc.target, tc.expected, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestTargetIDFromRouteOnly(t *testing.T) {
+	proxy := newConnectedProxy(t, "")
+	server := NewServer(proxy, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080"})
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/devtools/browser/fake?target_id=T1", nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(proxy.GetClients()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	clients := proxy.GetClients()
+	if len(clients) != 1 {
+		t.Fatalf("Expected 1 client, got %d", len(clients))
+	}
+	if targetID, ok := clients[0].Metadata["target_id"]; ok {
+		t.Errorf("Expected a browser client not to be bound to a target, got %v", targetID)
+	}
+}
+
+func TestReadyzChecksEveryBrowser(t *testing.T) {
+	server := NewServer(newConnectedProxy(t, ""), browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080", ReadinessTimeoutSeconds: 1})
+	if err := server.AddBrowser(newConnectedProxy(t, "chromium")); err != nil {
+		t.Fatalf("AddBrowser failed: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected /readyz to return 200, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	cfg := browser.DefaultConfig()
+	cfg.Name = "firefox"
+	cfg.BrowserURL = "http://127.0.0.1:1"
+	firefox, err := browser.NewCDPProxy(browser.NewEventDispatcher(), cfg)
+	if err != nil {
+		t.Fatalf("NewCDPProxy failed: %v", err)
+	}
+	defer firefox.Shutdown()
+	if err := server.AddBrowser(firefox); err != nil {
+		t.Fatalf("AddBrowser failed: %v", err)
+	}
+
+	type readyzResponse struct {
+		Status   string             `json:"status"`
+		Error    string             `json:"error"`
+		Browsers []browserReadiness `json:"browsers"`
+	}
+	readyz := func(server *Server) (int, readyzResponse) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+		var body readyzResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Invalid /readyz response: %v", err)
+		}
+		return rr.Code, body
+	}
+
+	// A named browser that is down does not take the others out of rotation.
+	code, body := readyz(server)
+	if code != http.StatusOK {
+		t.Fatalf("Expected /readyz to return 200 with firefox down, got %d", code)
+	}
+	if body.Status != "degraded" || !strings.Contains(body.Error, "firefox") || len(body.Browsers) != 3 || !body.Browsers[0].Default || !body.Browsers[1].Ready || body.Browsers[2].Ready {
+		t.Errorf("Unexpected /readyz response %+v", body)
+	}
+
+	// The default browser being down is.
+	cfg = browser.DefaultConfig()
+	cfg.BrowserURL = "http://127.0.0.1:1"
+	unreachable, err := browser.NewCDPProxy(browser.NewEventDispatcher(), cfg)
+	if err != nil {
+		t.Fatalf("NewCDPProxy failed: %v", err)
+	}
+	defer unreachable.Shutdown()
+
+	server = NewServer(unreachable, browser.NewEventDispatcher(), "8080", &config.Config{Port: "8080", ReadinessTimeoutSeconds: 1})
+	if err := server.AddBrowser(newConnectedProxy(t, "chromium")); err != nil {
+		t.Fatalf("AddBrowser failed: %v", err)
+	}
+
+	code, body = readyz(server)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected /readyz to return 503 with the default browser down, got %d", code)
+	}
+	if body.Status != "not_ready" || !strings.Contains(body.Error, "default") || len(body.Browsers) != 2 || body.Browsers[0].Ready || !body.Browsers[1].Ready {
+		t.Errorf("Unexpected /readyz response %+v", body)
+	}
+}
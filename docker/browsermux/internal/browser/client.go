@@ -2,10 +2,13 @@ package browser
 
 import (
 	"errors"
-	"log"
+	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"browsermux/internal/logging"
 )
 
 const (
@@ -15,12 +18,104 @@ const (
 	maxMessageSize = 512 * 1024
 )
 
+func (p *CDPProxy) clientPongWait() time.Duration {
+	if p.config.ClientPongWait <= 0 {
+		return pongWait
+	}
+	return p.config.ClientPongWait
+}
+
+// clientPingInterval leaves clients a tenth of the pong wait to answer.
+func (p *CDPProxy) clientPingInterval() time.Duration {
+	switch {
+	case p.config.ClientPingInterval > 0:
+		return p.config.ClientPingInterval
+	case p.config.ClientPongWait > 0:
+		return p.config.ClientPongWait * 9 / 10
+	}
+	return pingPeriod
+}
+
+func (p *CDPProxy) clientWriteWait() time.Duration {
+	if p.config.ClientWriteWait <= 0 {
+		return writeWait
+	}
+	return p.config.ClientWriteWait
+}
+
+// clientStats are per-client counters updated on the delivery hot path.
+type clientStats struct {
+	dropped       atomic.Uint64
+	sampled       atomic.Uint64
+	sampleCounter atomic.Uint64
+	evicted       atomic.Bool
+	// trace logs every message to and from the client in full.
+	trace atomic.Bool
+
+	messagesReceived atomic.Uint64
+	messagesSent     atomic.Uint64
+	bytesReceived    atomic.Uint64
+	bytesSent        atomic.Uint64
+	// lastActivity is the Unix time in nanoseconds of the last message in
+	// either direction.
+	lastActivity atomic.Int64
+	lastMethod   atomic.Value
+	// disconnect is why the connection ended, set once by whoever noticed
+	// first.
+	disconnect atomic.Pointer[disconnectInfo]
+}
+
+// disconnectInfo is the close code and reason reported in the
+// client.disconnected event.
+type disconnectInfo struct {
+	code   int
+	reason string
+}
+
+// recordReceived counts a message read from the client. method is the CDP
+// method of commands, empty otherwise.
+func (s *clientStats) recordReceived(size int, method string) {
+	s.messagesReceived.Add(1)
+	s.bytesReceived.Add(uint64(size))
+	s.lastActivity.Store(time.Now().UnixNano())
+	if method != "" {
+		s.lastMethod.Store(method)
+	}
+}
+
+// recordSent counts a message written to the client.
+func (s *clientStats) recordSent(size int) {
+	s.messagesSent.Add(1)
+	s.bytesSent.Add(uint64(size))
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
 func (c *Client) ToModel() *ClientDTO {
+	var lastActivity *time.Time
+	if nanos := c.stats.lastActivity.Load(); nanos != 0 {
+		t := time.Unix(0, nanos)
+		lastActivity = &t
+	}
+	lastMethod, _ := c.stats.lastMethod.Load().(string)
+
 	return &ClientDTO{
-		ID:        c.ID,
-		Connected: c.Connected,
-		Metadata:  c.Metadata,
-		CreatedAt: c.CreatedAt,
+		ID:              c.ID,
+		Connected:       c.Connected,
+		Metadata:        c.Metadata,
+		CreatedAt:       c.CreatedAt,
+		Role:            c.role(),
+		QueueDepth:      len(c.Send),
+		QueueCapacity:   cap(c.Send),
+		DroppedMessages: c.stats.dropped.Load(),
+		SampledEvents:   c.stats.sampled.Load(),
+		ProtocolTrace:   c.stats.trace.Load(),
+
+		MessagesReceived: c.stats.messagesReceived.Load(),
+		MessagesSent:     c.stats.messagesSent.Load(),
+		BytesReceived:    c.stats.bytesReceived.Load(),
+		BytesSent:        c.stats.bytesSent.Load(),
+		LastActivity:     lastActivity,
+		LastMethod:       lastMethod,
 	}
 }
 
@@ -37,6 +132,29 @@ func NewClient(id string, conn *websocket.Conn, dispatcher EventDispatcher, cdpP
 	}
 }
 
+func (c *Client) role() ClientRole {
+	if c.Role == "" {
+		return ClientRoleController
+	}
+	return c.Role
+}
+
+// logger returns the default logger with the client's ID and remote address.
+func (c *Client) logger() *slog.Logger {
+	if remoteAddr, ok := c.Metadata[logging.KeyRemoteAddr].(string); ok {
+		return slog.With(logging.KeyClientID, c.ID, logging.KeyRemoteAddr, remoteAddr)
+	}
+	return slog.With(logging.KeyClientID, c.ID)
+}
+
+// traceMessage logs a full message when protocol tracing is on for the client.
+func (c *Client) traceMessage(direction string, message []byte) {
+	if !c.stats.trace.Load() {
+		return
+	}
+	c.logger().Info("Protocol trace", "direction", direction, "message", string(message))
+}
+
 func (c *Client) Close() error {
 	c.Connected = false
 
@@ -50,6 +168,49 @@ func (c *Client) Close() error {
 	return c.Conn.Close()
 }
 
+// closeConn sends a close frame with the given code and reason before closing
+// the connection. The read loop then notices and removes the client.
+func (c *Client) closeConn(code int, reason string) error {
+	if c.Conn == nil {
+		return nil
+	}
+
+	c.setDisconnectReason(code, reason)
+	closeMsg := websocket.FormatCloseMessage(code, reason)
+	_ = c.Conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(writeWait))
+	return c.Conn.Close()
+}
+
+// setDisconnectReason records why the connection ends. The first reason wins,
+// so the read loop does not overwrite the cause of a close it only observed.
+func (c *Client) setDisconnectReason(code int, reason string) {
+	c.stats.disconnect.CompareAndSwap(nil, &disconnectInfo{code: code, reason: reason})
+}
+
+// readErrorReason describes a failed read from a client: the client's close
+// frame, a missed pong or a broken connection.
+func readErrorReason(err error) (int, string) {
+	var closeErr *websocket.CloseError
+	switch {
+	case errors.As(err, &closeErr):
+		if closeErr.Text == "" {
+			return closeErr.Code, "client closed connection"
+		}
+		return closeErr.Code, closeErr.Text
+	case isTimeout(err):
+		return websocket.CloseAbnormalClosure, "pong timeout"
+	}
+	return websocket.CloseAbnormalClosure, "read error: " + err.Error()
+}
+
+// writeErrorReason describes a failed write to a client.
+func writeErrorReason(err error) (int, string) {
+	if isTimeout(err) {
+		return websocket.CloseAbnormalClosure, "write timeout"
+	}
+	return websocket.CloseAbnormalClosure, "write error: " + err.Error()
+}
+
 func (c *Client) SendMessage(message []byte) error {
 	select {
 	case c.Send <- message:
@@ -62,7 +223,7 @@ func (c *Client) SendMessage(message []byte) error {
 func (c *Client) ProcessMessage(message []byte) {
 	cdpMsg, err := ParseCDPMessage(message)
 	if err == nil {
-		log.Printf("Received message from client %s: %s (id: %d)", c.ID, cdpMsg.Method, cdpMsg.ID)
+		c.logger().Debug("Received message from client", logging.KeyMethod, cdpMsg.Method, logging.KeyCDPID, cdpMsg.ID, logging.KeySessionID, cdpMsg.SessionID)
 
 		c.Dispatcher.Dispatch(Event{
 			Type:       EventCDPCommand,
@@ -73,7 +234,7 @@ func (c *Client) ProcessMessage(message []byte) {
 			Timestamp:  time.Now(),
 		})
 	} else {
-		log.Printf("Received message from client %s: %s", c.ID, string(message))
+		c.logger().Debug("Received unparseable message from client", "message", string(message))
 	}
 
 	c.CDPProxy.HandleClientMessage(c.ID, message)
@@ -0,0 +1,286 @@
+package browser
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"browsermux/internal/logging"
+)
+
+// Pseudo-domains for the Target toggles that behave like <Domain>.enable.
+const (
+	targetDiscoveryDomain = "Target.discover"
+	autoAttachDomain      = "Target.autoAttach"
+)
+
+type domainKey struct {
+	sessionID string
+	domain    string
+}
+
+// domainEnable is the command that turned a domain on, kept so that it can be
+// re-issued after a reconnect.
+type domainEnable struct {
+	method string
+	params map[string]interface{}
+}
+
+// domainTable reference-counts domain enables across the clients sharing the
+// browser connection. Only the first enable and the last disable of a domain
+// on a session are forwarded upstream; holders are kept in enable order.
+//
+// Later holders therefore miss the events the browser sends while enabling a
+// domain, such as Runtime.executionContextCreated for existing contexts. Only
+// target discovery is replayed to them, see replayTargets.
+type domainTable struct {
+	mu      sync.Mutex
+	holders map[domainKey][]string
+	enables map[domainKey]domainEnable
+}
+
+// acquire registers the client as a holder of the domain and reports whether
+// the enable has to be forwarded. Repeated enables from the only holder are
+// forwarded as well so that it can still change parameters.
+func (t *domainTable) acquire(key domainKey, clientID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.holders == nil {
+		t.holders = make(map[domainKey][]string)
+	}
+
+	holders := t.holders[key]
+	if indexOf(holders, clientID) == -1 {
+		t.holders[key] = append(holders, clientID)
+	}
+	return len(holders) == 0 || (len(holders) == 1 && holders[0] == clientID)
+}
+
+// release drops the client from the domain's holders and reports whether the
+// disable has to be forwarded, i.e. nobody else still relies on the domain.
+func (t *domainTable) release(key domainKey, clientID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	holders := t.holders[key]
+	if i := indexOf(holders, clientID); i != -1 {
+		holders = append(holders[:i:i], holders[i+1:]...)
+	}
+
+	if len(holders) == 0 {
+		delete(t.holders, key)
+		delete(t.enables, key)
+		return true
+	}
+	t.holders[key] = holders
+	return false
+}
+
+// remember records the enable command last forwarded for the domain.
+func (t *domainTable) remember(key domainKey, method string, params map[string]interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.enables == nil {
+		t.enables = make(map[domainKey]domainEnable)
+	}
+	t.enables[key] = domainEnable{method: method, params: params}
+}
+
+// snapshot returns the enable commands of every domain still held.
+func (t *domainTable) snapshot() map[domainKey]domainEnable {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	enables := make(map[domainKey]domainEnable, len(t.enables))
+	for key, enable := range t.enables {
+		if len(t.holders[key]) > 0 {
+			enables[key] = enable
+		}
+	}
+	return enables
+}
+
+// subscribers returns the clients that enabled the domain, or nil when nobody
+// enabled it through the proxy and events should not be filtered.
+func (t *domainTable) subscribers(key domainKey) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.holders[key]...)
+}
+
+func (t *domainTable) firstHolder(key domainKey) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if holders := t.holders[key]; len(holders) > 0 {
+		return holders[0]
+	}
+	return ""
+}
+
+// dropClient removes the client from every domain and returns the domains
+// nobody holds anymore, which still have to be disabled upstream.
+func (t *domainTable) dropClient(clientID string) []domainKey {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var released []domainKey
+	for key, holders := range t.holders {
+		i := indexOf(holders, clientID)
+		if i == -1 {
+			continue
+		}
+
+		holders = append(holders[:i:i], holders[i+1:]...)
+		if len(holders) == 0 {
+			delete(t.holders, key)
+			delete(t.enables, key)
+			released = append(released, key)
+		} else {
+			t.holders[key] = holders
+		}
+	}
+	return released
+}
+
+func (t *domainTable) dropSession(sessionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key := range t.holders {
+		if key.sessionID == sessionID {
+			delete(t.holders, key)
+			delete(t.enables, key)
+		}
+	}
+}
+
+// domainToggle reports the domain a command enables or disables, if any.
+func domainToggle(cdpMsg *CDPMessage) (domain string, enable bool, ok bool) {
+	switch cdpMsg.Method {
+	case "Target.setDiscoverTargets":
+		discover, _ := cdpMsg.Params["discover"].(bool)
+		return targetDiscoveryDomain, discover, true
+	case "Target.setAutoAttach":
+		autoAttach, _ := cdpMsg.Params["autoAttach"].(bool)
+		return autoAttachDomain, autoAttach, true
+	}
+
+	domain, action, found := strings.Cut(cdpMsg.Method, ".")
+	if !found {
+		return "", false, false
+	}
+
+	switch action {
+	case "enable":
+		return domain, true, true
+	case "disable":
+		return domain, false, true
+	}
+	return "", false, false
+}
+
+// eventDomain returns the domain whose enable controls delivery of the event,
+// or "" for events that are routed by session ownership instead.
+func eventDomain(method string) string {
+	switch method {
+	case "Target.targetCreated", "Target.targetDestroyed", "Target.targetInfoChanged", "Target.targetCrashed":
+		return targetDiscoveryDomain
+	case "Target.attachedToTarget", "Target.detachedFromTarget", "Target.receivedMessageFromTarget":
+		return ""
+	}
+
+	domain, _, _ := strings.Cut(method, ".")
+	return domain
+}
+
+// applyDomainToggle reference-counts an enable or disable command. It returns
+// false when the command was answered by the proxy and must not be forwarded.
+func (p *CDPProxy) applyDomainToggle(clientID string, cdpMsg *CDPMessage, domain string, enable bool) bool {
+	key := domainKey{sessionID: cdpMsg.SessionID, domain: domain}
+
+	forward := false
+	if enable {
+		forward = p.domains.acquire(key, clientID)
+		if forward {
+			p.domains.remember(key, cdpMsg.Method, cdpMsg.Params)
+		}
+	} else {
+		forward = p.domains.release(key, clientID)
+	}
+
+	if forward {
+		return true
+	}
+	if enable && domain == targetDiscoveryDomain {
+		p.replayTargets(clientID, cdpMsg)
+	} else {
+		p.respond(clientID, cdpMsg, nil, nil)
+	}
+	return false
+}
+
+// replayTargets answers a Target.setDiscoverTargets that another client's
+// discovery already covers. The browser only announces existing targets when
+// discovery is switched on, so they are listed and sent to the client as
+// Target.targetCreated ahead of the response, as the browser does.
+func (p *CDPProxy) replayTargets(clientID string, cmd *CDPMessage) {
+	var params map[string]interface{}
+	if filter, ok := cmd.Params["filter"]; ok {
+		params = map[string]interface{}{"filter": filter}
+	}
+
+	_, err := p.sendInternalCommand(cmd.SessionID, "Target.getTargets", params, func(response *CDPMessage) {
+		var result struct {
+			TargetInfos []map[string]interface{} `json:"targetInfos"`
+		}
+		if response.Error != nil {
+			slog.Warn("Failed to list targets for discovery", logging.KeyClientID, clientID, "error", response.Error.Message)
+		} else if err := json.Unmarshal(response.Result, &result); err != nil {
+			slog.Warn("Failed to list targets for discovery", logging.KeyClientID, clientID, "error", err)
+		}
+
+		for _, info := range result.TargetInfos {
+			p.notifyClient(clientID, "Target.targetCreated", map[string]interface{}{"targetInfo": info})
+		}
+		p.respond(clientID, cmd, nil, nil)
+	})
+	if err != nil {
+		slog.Warn("Failed to list targets for discovery", logging.KeyClientID, clientID, "error", err)
+		p.respond(clientID, cmd, nil, nil)
+	}
+}
+
+// disableDomains turns off domains the last holder left enabled.
+func (p *CDPProxy) disableDomains(keys []domainKey) {
+	for _, key := range keys {
+		method := key.domain + ".disable"
+		var params map[string]interface{}
+
+		switch key.domain {
+		case targetDiscoveryDomain:
+			method = "Target.setDiscoverTargets"
+			params = map[string]interface{}{"discover": false}
+		case autoAttachDomain:
+			method = "Target.setAutoAttach"
+			params = map[string]interface{}{"autoAttach": false, "waitForDebuggerOnStart": false}
+		}
+
+		if _, err := p.sendInternalCommand(key.sessionID, method, params, nil); err != nil {
+			slog.Warn("Failed to disable domain", logging.KeyMethod, method, logging.KeySessionID, key.sessionID, "error", err)
+		}
+	}
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
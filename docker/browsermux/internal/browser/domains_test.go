@@ -0,0 +1,114 @@
+package browser
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDomainReferenceCounting(t *testing.T) {
+	proxy := newRoutingTestProxy("a", "b")
+
+	if _, ok := proxy.prepareClientMessage("a", []byte(`{"id":1,"method":"Network.enable","params":{}}`)); !ok {
+		t.Fatal("Expected first Network.enable to be forwarded")
+	}
+
+	if _, ok := proxy.prepareClientMessage("b", []byte(`{"id":5,"method":"Network.enable","params":{}}`)); ok {
+		t.Fatal("Expected second Network.enable to be answered by the proxy")
+	}
+
+	response := receiveMessage(t, proxy.clients["b"])
+	if response.ID != 5 || response.Error != nil || string(response.Result) != "{}" {
+		t.Errorf("Expected synthetic success for id 5, got %+v", response)
+	}
+
+	t.Run("Disable while another client holds the domain", func(t *testing.T) {
+		if _, ok := proxy.prepareClientMessage("a", []byte(`{"id":2,"method":"Network.disable"}`)); ok {
+			t.Fatal("Expected Network.disable to be absorbed while b still needs Network")
+		}
+		if response := receiveMessage(t, proxy.clients["a"]); response.ID != 2 || response.Error != nil {
+			t.Errorf("Expected synthetic success for id 2, got %+v", response)
+		}
+	})
+
+	t.Run("Events only reach clients that enabled the domain", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Network.requestWillBeSent","params":{}}`))
+		receiveMessage(t, proxy.clients["b"])
+		expectNoMessage(t, proxy.clients["a"])
+	})
+
+	t.Run("Events of untracked domains are broadcast", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Inspector.detached","params":{"reason":"x"}}`))
+		receiveMessage(t, proxy.clients["a"])
+		receiveMessage(t, proxy.clients["b"])
+	})
+
+	t.Run("Last disable is forwarded", func(t *testing.T) {
+		if _, ok := proxy.prepareClientMessage("b", []byte(`{"id":6,"method":"Network.disable"}`)); !ok {
+			t.Fatal("Expected the last Network.disable to be forwarded")
+		}
+	})
+
+	t.Run("Removing the last holder disables upstream", func(t *testing.T) {
+		proxy.prepareClientMessage("a", []byte(`{"id":3,"method":"Target.setDiscoverTargets","params":{"discover":true}}`))
+
+		released := proxy.domains.dropClient("a")
+		proxy.disableDomains(released)
+
+		msg := readBrowserMessage(t, proxy)
+		if msg.Method != "Target.setDiscoverTargets" || msg.Params["discover"] != false {
+			t.Errorf("Expected discovery to be turned off, got %+v", msg)
+		}
+	})
+}
+
+func TestTargetDiscoveryReplay(t *testing.T) {
+	proxy := newRoutingTestProxy("a", "b")
+
+	if _, ok := proxy.prepareClientMessage("a", []byte(`{"id":1,"method":"Target.setDiscoverTargets","params":{"discover":true}}`)); !ok {
+		t.Fatal("Expected the first Target.setDiscoverTargets to be forwarded")
+	}
+	if _, ok := proxy.prepareClientMessage("b", []byte(`{"id":4,"method":"Target.setDiscoverTargets","params":{"discover":true}}`)); ok {
+		t.Fatal("Expected the second Target.setDiscoverTargets to be answered by the proxy")
+	}
+
+	list := readBrowserMessage(t, proxy)
+	if list.Method != "Target.getTargets" {
+		t.Fatalf("Expected the proxy to list the targets, got %+v", list)
+	}
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"targetInfos":[{"targetId":"T1","type":"page"},{"targetId":"T2","type":"page"}]}}`, list.ID)))
+
+	for _, targetID := range []string{"T1", "T2"} {
+		event := receiveMessage(t, proxy.clients["b"])
+		info, _ := event.Params["targetInfo"].(map[string]interface{})
+		if event.Method != "Target.targetCreated" || info["targetId"] != targetID {
+			t.Errorf("Expected Target.targetCreated for %s, got %+v", targetID, event)
+		}
+	}
+	if response := receiveMessage(t, proxy.clients["b"]); response.ID != 4 || response.Error != nil {
+		t.Errorf("Expected success for id 4 after the targets, got %+v", response)
+	}
+	expectNoMessage(t, proxy.clients["a"])
+}
+
+func TestDomainToggle(t *testing.T) {
+	tests := []struct {
+		message string
+		domain  string
+		enable  bool
+		ok      bool
+	}{
+		{`{"id":1,"method":"Page.enable"}`, "Page", true, true},
+		{`{"id":1,"method":"Runtime.disable"}`, "Runtime", false, true},
+		{`{"id":1,"method":"Target.setAutoAttach","params":{"autoAttach":true}}`, autoAttachDomain, true, true},
+		{`{"id":1,"method":"Target.setDiscoverTargets","params":{"discover":false}}`, targetDiscoveryDomain, false, true},
+		{`{"id":1,"method":"Page.navigate","params":{"url":"about:blank"}}`, "", false, false},
+	}
+
+	for _, test := range tests {
+		msg, _ := ParseCDPMessage([]byte(test.message))
+		domain, enable, ok := domainToggle(msg)
+		if domain != test.domain || enable != test.enable || ok != test.ok {
+			t.Errorf("domainToggle(%s) = (%q, %v, %v), want (%q, %v, %v)", test.message, domain, enable, ok, test.domain, test.enable, test.ok)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/logging"
+)
+
+// DefaultEvictReason is the close reason sent to evicted clients that were not
+// given one.
+const DefaultEvictReason = "evicted by administrator"
+
+var ErrInvalidCloseCode = errors.New("invalid close code")
+
+// ValidCloseCode reports whether a server may send code in a close frame: the
+// standard codes other than 1010, which only clients send, or an application
+// code from 3000 to 4999.
+func ValidCloseCode(code int) bool {
+	switch {
+	case code == websocket.CloseMandatoryExtension:
+		return false
+	case code == websocket.CloseNormalClosure, code == websocket.CloseGoingAway,
+		code == websocket.CloseProtocolError, code == websocket.CloseUnsupportedData,
+		code >= websocket.CloseInvalidFramePayloadData && code <= websocket.CloseInternalServerErr:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// EvictClient closes a client's connection with the given close code and
+// reason and removes it. requestedBy names who asked for the eviction and is
+// recorded in the client.evicted event.
+func (p *CDPProxy) EvictClient(clientID string, code int, reason, requestedBy string) error {
+	if !ValidCloseCode(code) {
+		return fmt.Errorf("%w: %d", ErrInvalidCloseCode, code)
+	}
+	if reason == "" {
+		reason = DefaultEvictReason
+	}
+
+	p.mu.RLock()
+	client, exists := p.clients[clientID]
+	p.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+
+	p.evict(client, code, reason, requestedBy)
+	return nil
+}
+
+// EvictClients evicts every client whose metadata has all the selector's
+// values and returns their IDs. An empty selector matches no client.
+func (p *CDPProxy) EvictClients(selector map[string]string, code int, reason, requestedBy string) ([]string, error) {
+	if !ValidCloseCode(code) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidCloseCode, code)
+	}
+	if reason == "" {
+		reason = DefaultEvictReason
+	}
+
+	var matched []*Client
+	if len(selector) > 0 {
+		p.mu.RLock()
+		for _, client := range p.clients {
+			if matchesMetadata(client.Metadata, selector) {
+				matched = append(matched, client)
+			}
+		}
+		p.mu.RUnlock()
+	}
+
+	evicted := make([]string, 0, len(matched))
+	for _, client := range matched {
+		p.evict(client, code, reason, requestedBy)
+		evicted = append(evicted, client.ID)
+	}
+	sort.Strings(evicted)
+	return evicted, nil
+}
+
+func (p *CDPProxy) evict(client *Client, code int, reason, requestedBy string) {
+	client.logger().Info("Evicting client", "code", code, "reason", reason, "requested_by", requestedBy)
+
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventClientEvicted,
+		SourceID:   client.ID,
+		SourceType: "client",
+		Timestamp:  time.Now(),
+		Params: map[string]interface{}{
+			"client_id":    client.ID,
+			"code":         code,
+			"reason":       reason,
+			"requested_by": requestedBy,
+		},
+	})
+
+	if err := client.closeConn(code, reason); err != nil {
+		slog.Debug("Error closing client", logging.KeyClientID, client.ID, "error", err)
+	}
+	p.RemoveClient(client.ID)
+}
+
+func matchesMetadata(metadata map[string]interface{}, selector map[string]string) bool {
+	for key, expected := range selector {
+		value, ok := metadata[key]
+		if !ok || fmt.Sprint(value) != expected {
+			return false
+		}
+	}
+	return true
+}
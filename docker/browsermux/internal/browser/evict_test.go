@@ -0,0 +1,123 @@
+package browser
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestClient returns the server side of a WebSocket connection, as the
+// proxy holds it, and the peer's side.
+func dialTestClient(t *testing.T) (server, peer *websocket.Conn) {
+	t.Helper()
+
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(ts.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to dial test server: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	return <-conns, peer
+}
+
+func TestEvictClient(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	conn, peer := dialTestClient(t)
+	proxy.clients["a"].Conn = conn
+	proxy.clients["a"].Dispatcher = proxy.eventDispatcher
+
+	if err := proxy.EvictClient("a", 1005, "", "ops"); !errors.Is(err, ErrInvalidCloseCode) {
+		t.Errorf("Expected ErrInvalidCloseCode, got %v", err)
+	}
+	if err := proxy.EvictClient("missing", websocket.CloseNormalClosure, "", "ops"); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+
+	if err := proxy.EvictClient("a", 4001, "stale session", "ops"); err != nil {
+		t.Fatalf("EvictClient failed: %v", err)
+	}
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := peer.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != 4001 || closeErr.Text != "stale session" {
+		t.Errorf("Expected close frame 4001 'stale session', got %v", err)
+	}
+
+	if proxy.GetClientCount() != 0 {
+		t.Error("Expected evicted client to be removed")
+	}
+
+	var evicted *Event
+	for _, event := range proxy.eventDispatcher.(*mockDispatcher).events {
+		if event.Type == EventClientEvicted {
+			evicted = &event
+		}
+	}
+	if evicted == nil || evicted.Params["requested_by"] != "ops" || evicted.Params["code"] != 4001 {
+		t.Errorf("Expected client.evicted event naming the requester, got %+v", evicted)
+	}
+	if !hasEvent(proxy, EventClientDisconnected) {
+		t.Error("Expected client.disconnected event")
+	}
+}
+
+func TestEvictClientsBySelector(t *testing.T) {
+	proxy := newRoutingTestProxy("a", "b", "c")
+	proxy.clients["a"].Metadata = map[string]interface{}{"tag": "run-1", "user_agent": "puppeteer"}
+	proxy.clients["b"].Metadata = map[string]interface{}{"tag": "run-2", "user_agent": "puppeteer"}
+	proxy.clients["c"].Metadata = map[string]interface{}{"tag": "run-1", "user_agent": "playwright"}
+
+	evicted, err := proxy.EvictClients(map[string]string{"tag": "run-1", "user_agent": "puppeteer"}, websocket.CloseNormalClosure, "", "ops")
+	if err != nil || strings.Join(evicted, ",") != "a" {
+		t.Fatalf("Expected only a to be evicted, got %v, %v", evicted, err)
+	}
+
+	evicted, _ = proxy.EvictClients(map[string]string{"user_agent": "puppeteer"}, websocket.CloseNormalClosure, "", "ops")
+	if strings.Join(evicted, ",") != "b" {
+		t.Errorf("Expected b to be evicted, got %v", evicted)
+	}
+
+	evicted, _ = proxy.EvictClients(nil, websocket.CloseNormalClosure, "", "ops")
+	if len(evicted) != 0 || proxy.GetClientCount() != 1 {
+		t.Errorf("Expected an empty selector to evict nobody, got %v", evicted)
+	}
+}
+
+func TestValidCloseCode(t *testing.T) {
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{1000, true},
+		{1004, false},
+		{1005, false},
+		{1008, true},
+		{1010, false},
+		{1011, true},
+		{2999, false},
+		{4001, true},
+		{5000, false},
+	}
+	for _, tt := range tests {
+		if got := ValidCloseCode(tt.code); got != tt.want {
+			t.Errorf("ValidCloseCode(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrBrowserNotConnected = errors.New("browser not connected")
+
+// Health describes the upstream connection as seen by the proxy.
+type Health struct {
+	Connected      bool            `json:"connected"`
+	State          ConnectionState `json:"state"`
+	LastPing       *time.Time      `json:"last_ping,omitempty"`
+	LastPingMillis float64         `json:"last_ping_ms,omitempty"`
+	ReconnectCount uint64          `json:"reconnect_count"`
+	LastError      string          `json:"last_error,omitempty"`
+	LastErrorAt    *time.Time      `json:"last_error_at,omitempty"`
+}
+
+// healthState records the outcome of pings and connection attempts.
+type healthState struct {
+	mu          sync.Mutex
+	lastPing    time.Time
+	pingLatency time.Duration
+	reconnects  uint64
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func (h *healthState) recordPing(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastPing = time.Now()
+	h.pingLatency = latency
+}
+
+func (h *healthState) recordError(err error) {
+	if err == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastError = err.Error()
+	h.lastErrorAt = time.Now()
+}
+
+func (h *healthState) recordReconnect() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.reconnects++
+}
+
+// Ping sends Browser.getVersion over the upstream connection and waits for
+// the answer until ctx is done. It returns the round-trip time.
+func (p *CDPProxy) Ping(ctx context.Context) (time.Duration, error) {
+	if !p.IsConnected() {
+		return 0, ErrBrowserNotConnected
+	}
+
+	start := time.Now()
+	responses := make(chan *CDPMessage, 1)
+	proxyID, err := p.sendTrackedCommand(&pendingCommand{
+		method: "Browser.getVersion",
+		sentAt: start,
+		callback: func(response *CDPMessage) {
+			responses <- response
+		},
+		probe: true,
+	}, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case response := <-responses:
+		if response.Error != nil {
+			err := fmt.Errorf("Browser.getVersion failed: %s", response.Error.Message)
+			p.health.recordError(err)
+			return 0, err
+		}
+		latency := time.Since(start)
+		p.health.recordPing(latency)
+		return latency, nil
+	case <-ctx.Done():
+		// A late answer is discarded like any other unknown response.
+		p.commands.resolve(proxyID)
+		err := fmt.Errorf("Browser.getVersion: %w", ctx.Err())
+		p.health.recordError(err)
+		return 0, err
+	}
+}
+
+// Health reports the connection state, the last successful ping, how often
+// the proxy reconnected and the last connection or ping error.
+func (p *CDPProxy) Health() Health {
+	health := Health{Connected: p.IsConnected(), State: p.State()}
+
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+
+	if !p.health.lastPing.IsZero() {
+		lastPing := p.health.lastPing
+		health.LastPing = &lastPing
+		health.LastPingMillis = float64(p.health.pingLatency.Microseconds()) / 1000
+	}
+	health.ReconnectCount = p.health.reconnects
+	if p.health.lastError != "" {
+		lastErrorAt := p.health.lastErrorAt
+		health.LastError = p.health.lastError
+		health.LastErrorAt = &lastErrorAt
+	}
+	return health
+}
@@ -0,0 +1,69 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	proxy := newRoutingTestProxy()
+
+	go func() {
+		raw := <-proxy.browserMessages
+		msg, _ := ParseCDPMessage(raw)
+		proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"product":"Chrome/120"}}`, msg.ID)))
+	}()
+
+	if _, err := proxy.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	health := proxy.Health()
+	if !health.Connected || health.LastPing == nil || health.LastError != "" {
+		t.Errorf("Unexpected health after a successful ping: %+v", health)
+	}
+
+	// The browser never answers the second ping.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := proxy.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the ping to time out, got %v", err)
+	}
+	if health := proxy.Health(); health.LastError == "" || health.LastErrorAt == nil {
+		t.Errorf("Expected the timeout to be recorded, got %+v", health)
+	}
+}
+
+func TestPingCancelled(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	proxy.config.CommandTimeout = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := proxy.Ping(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the ping to be cancelled, got %v", err)
+	}
+
+	if pending := len(proxy.commands.pending); pending != 0 {
+		t.Errorf("Expected the cancelled ping to leave the tracker, %d commands pending", pending)
+	}
+}
+
+func TestPingDisconnected(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	proxy.handleBrowserDisconnect(errors.New("connection reset"))
+	proxy.handleBrowserReconnected()
+
+	proxy.connected = false
+	if _, err := proxy.Ping(context.Background()); !errors.Is(err, ErrBrowserNotConnected) {
+		t.Errorf("Expected ErrBrowserNotConnected, got %v", err)
+	}
+
+	health := proxy.Health()
+	if health.Connected || health.ReconnectCount != 1 || health.LastError != "connection reset" {
+		t.Errorf("Unexpected health %+v", health)
+	}
+}
@@ -0,0 +1,106 @@
+package browser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/metrics"
+)
+
+var ErrBrowserStalled = errors.New("browser stalled")
+
+const (
+	defaultKeepaliveInterval = 15 * time.Second
+	defaultStallTimeout      = 10 * time.Second
+)
+
+// keepalive probes the browser with Browser.getVersion every
+// KeepaliveInterval. A probe that is not answered within StallTimeout marks
+// the browser as stalled.
+func (p *CDPProxy) keepalive() {
+	if p.config.KeepaliveInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(p.config.KeepaliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.shutdown:
+			return
+		}
+
+		browserConn, ok := p.upstream()
+		if !ok {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.stallTimeout())
+		_, err := p.Ping(ctx)
+		cancel()
+
+		if errors.Is(err, context.DeadlineExceeded) {
+			p.markStalled(browserConn, fmt.Sprintf("no answer to Browser.getVersion within %s", p.stallTimeout()))
+		}
+	}
+}
+
+func (p *CDPProxy) stallTimeout() time.Duration {
+	if p.config.StallTimeout <= 0 {
+		return defaultStallTimeout
+	}
+	return p.config.StallTimeout
+}
+
+// readTimeout is how long the browser connection may stay silent. Probes
+// cause traffic every KeepaliveInterval, so a longer silence means the browser
+// stalled. Zero means keepalive is off and reads never time out.
+func (p *CDPProxy) readTimeout() time.Duration {
+	if p.config.KeepaliveInterval <= 0 {
+		return 0
+	}
+	return p.config.KeepaliveInterval + p.stallTimeout()
+}
+
+// markStalled reports browserConn as stalled and closes it, which makes
+// processBrowserMessages run the disconnect and reconnect path. It does
+// nothing if browserConn was already replaced or reported.
+func (p *CDPProxy) markStalled(browserConn *websocket.Conn, reason string) {
+	p.mu.Lock()
+	if p.browserConn != browserConn || !p.connected || p.state == StateStalled {
+		p.mu.Unlock()
+		return
+	}
+	previous := p.state
+	p.state = StateStalled
+	p.mu.Unlock()
+
+	slog.Error("Browser stalled, reconnecting", "reason", reason)
+	metrics.BrowserStalls.WithLabelValues(p.Name()).Inc()
+	p.health.recordError(errors.New(reason))
+
+	p.dispatchStateChange(StateStalled, previous, map[string]interface{}{"reason": reason})
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventBrowserStalled,
+		SourceType: "browser",
+		Timestamp:  time.Now(),
+		Params: map[string]interface{}{
+			"reason": reason,
+		},
+	})
+
+	browserConn.Close()
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,85 @@
+package browser
+
+import (
+	"testing"
+	"time"
+)
+
+// newStallTestProxy returns a proxy connected to a browser that never
+// answers.
+func newStallTestProxy(t *testing.T) *CDPProxy {
+	t.Helper()
+
+	_, browserConn := dialTestClient(t)
+
+	proxy := newRoutingTestProxy()
+	proxy.browserConn = browserConn
+	proxy.state = StateConnected
+	proxy.config.BrowserURL = "http://127.0.0.1:1"
+	proxy.config.KeepaliveInterval = 10 * time.Millisecond
+	proxy.config.StallTimeout = 20 * time.Millisecond
+	proxy.config.Reconnect = ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 1}
+	return proxy
+}
+
+// runUntil runs fn in the background until the proxy reaches state, then
+// shuts the proxy down and waits for fn to return.
+func runUntil(t *testing.T, proxy *CDPProxy, state ConnectionState, fn func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for proxy.State() != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for state %s, at %s", state, proxy.State())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(proxy.shutdown)
+	<-done
+}
+
+func TestKeepaliveDetectsStall(t *testing.T) {
+	proxy := newStallTestProxy(t)
+
+	runUntil(t, proxy, StateStalled, proxy.keepalive)
+
+	if !hasEvent(proxy, EventBrowserStalled) {
+		t.Error("Expected a browser.stalled event")
+	}
+	if health := proxy.Health(); health.LastError == "" {
+		t.Error("Expected the unanswered probe to be recorded")
+	}
+
+	// The stalled connection is closed so the reader reconnects.
+	if _, _, err := proxy.browserConn.ReadMessage(); err == nil {
+		t.Error("Expected the stalled connection to be closed")
+	}
+}
+
+func TestReadDeadlineDetectsStall(t *testing.T) {
+	proxy := newStallTestProxy(t)
+
+	// Without probes the silent connection runs into the read deadline, after
+	// which the proxy reconnects and gives up on the unreachable URL.
+	runUntil(t, proxy, StateFailed, proxy.processBrowserMessages)
+
+	var stalled, disconnected bool
+	for _, event := range proxy.eventDispatcher.(*mockDispatcher).events {
+		switch event.Type {
+		case EventBrowserStalled:
+			stalled = true
+		case EventBrowserDisconnected:
+			disconnected = event.Params["reason"] == ErrBrowserStalled.Error()
+		}
+	}
+	if !stalled || !disconnected {
+		t.Errorf("Expected browser.stalled and browser.disconnected events, got stalled=%v disconnected=%v", stalled, disconnected)
+	}
+}
@@ -0,0 +1,253 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/logging"
+)
+
+// LockMode decides how many clients may drive the browser at the same time.
+type LockMode string
+
+const (
+	// LockModeExclusive admits a single client and rejects everyone else.
+	LockModeExclusive LockMode = "exclusive"
+	// LockModeShared admits any number of controlling clients.
+	LockModeShared LockMode = "shared"
+	// LockModeControllerObservers admits one controller and any number of
+	// read-only observers.
+	LockModeControllerObservers LockMode = "controller+observers"
+)
+
+// ClientRole is what a connected client is allowed to do with the browser.
+type ClientRole string
+
+const (
+	ClientRoleController ClientRole = "controller"
+	ClientRoleObserver   ClientRole = "observer"
+)
+
+var (
+	ErrInvalidLockMode        = errors.New("invalid lock mode")
+	ErrLockModeOverrideDenied = errors.New("lock mode override not allowed")
+	ErrClientNotFound         = errors.New("client not found")
+	ErrNoLockHolder           = errors.New("session lock is not held")
+	ErrLockNotSupported       = errors.New("shared sessions have no lock holder")
+)
+
+// LockInfo describes who currently holds the session lock.
+type LockInfo struct {
+	Mode   LockMode   `json:"mode"`
+	Locked bool       `json:"locked"`
+	Holder *ClientDTO `json:"holder,omitempty"`
+}
+
+// ParseLockMode validates a lock mode name. An empty name selects the
+// exclusive mode.
+func ParseLockMode(mode string) (LockMode, error) {
+	switch LockMode(mode) {
+	case "":
+		return LockModeExclusive, nil
+	case LockModeExclusive, LockModeShared, LockModeControllerObservers:
+		return LockMode(mode), nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidLockMode, mode)
+}
+
+// lockModeFor returns the lock mode a new connection asked for, honouring the
+// lock_mode query parameter only when the config allows overrides.
+func (p *CDPProxy) lockModeFor(metadata map[string]interface{}) (LockMode, error) {
+	requested, _ := metadata["lock_mode"].(string)
+	if requested == "" {
+		return ParseLockMode(string(p.config.LockMode))
+	}
+
+	if !p.config.AllowLockModeOverride {
+		return "", ErrLockModeOverrideDenied
+	}
+	return ParseLockMode(requested)
+}
+
+// admitClient decides whether a client connecting with the given lock mode may
+// join and with which role. Clients that asked to be observers never take the
+// lock. When the client becomes the lock holder, holder is true. Callers must
+// hold p.mu.
+func (p *CDPProxy) admitClient(mode LockMode, requested ClientRole) (role ClientRole, holder bool, err error) {
+	if p.lockHolderID != "" {
+		if _, exists := p.clients[p.lockHolderID]; !exists {
+			p.lockHolderID = ""
+		}
+	}
+
+	if p.lockHolderID != "" {
+		if p.lockMode == LockModeExclusive || (mode == LockModeExclusive && requested != ClientRoleObserver) {
+			return "", false, ErrSessionLocked
+		}
+		return ClientRoleObserver, false, nil
+	}
+
+	if requested == ClientRoleObserver {
+		return ClientRoleObserver, false, nil
+	}
+
+	controllers := p.countClientsWithRole(ClientRoleController)
+
+	switch mode {
+	case LockModeShared:
+		return ClientRoleController, false, nil
+	case LockModeControllerObservers:
+		if controllers > 0 {
+			return ClientRoleObserver, false, nil
+		}
+		return ClientRoleController, true, nil
+	default:
+		if controllers > 0 {
+			return "", false, ErrSessionLocked
+		}
+		return ClientRoleController, true, nil
+	}
+}
+
+// countClientsWithRole counts connected clients with the role. Callers must
+// hold p.mu.
+func (p *CDPProxy) countClientsWithRole(role ClientRole) int {
+	count := 0
+	for _, client := range p.clients {
+		if client.role() == role {
+			count++
+		}
+	}
+	return count
+}
+
+// GetLock reports the current lock holder, if any.
+func (p *CDPProxy) GetLock() LockInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.lockInfo()
+}
+
+// TransferLock hands control of the session to another connected client. The
+// previous holder, if any, is demoted to an observer.
+func (p *CDPProxy) TransferLock(clientID string) (LockInfo, error) {
+	p.mu.Lock()
+
+	target, exists := p.clients[clientID]
+	if !exists {
+		p.mu.Unlock()
+		return LockInfo{}, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+
+	mode := p.lockMode
+	previousID := p.lockHolderID
+	if _, held := p.clients[previousID]; !held {
+		previousID = ""
+		mode, _ = ParseLockMode(string(p.config.LockMode))
+	}
+
+	if mode == LockModeShared {
+		p.mu.Unlock()
+		return LockInfo{}, ErrLockNotSupported
+	}
+
+	if previousID != "" && previousID != clientID {
+		p.clients[previousID].Role = ClientRoleObserver
+	}
+	target.Role = ClientRoleController
+	p.lockHolderID = clientID
+	p.lockMode = mode
+	p.recordClientRoles()
+
+	info := p.lockInfo()
+	p.mu.Unlock()
+
+	slog.Info("Session lock transferred", "previous_holder_id", previousID, logging.KeyClientID, clientID)
+
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventSessionLockTransferred,
+		SourceType: "proxy",
+		Timestamp:  time.Now(),
+		Params: map[string]interface{}{
+			"previous_holder_id": previousID,
+			"holder_id":          clientID,
+			"mode":               mode,
+		},
+	})
+
+	if previousID != "" && previousID != clientID {
+		p.notifyLockChange(previousID, ClientRoleObserver, clientID, "transferred")
+	}
+	p.notifyLockChange(clientID, ClientRoleController, clientID, "transferred")
+
+	return info, nil
+}
+
+// RevokeLock takes the session lock away from its holder so that a new client
+// can connect. The holder stays connected as an observer unless disconnect is
+// set, in which case its connection is closed.
+func (p *CDPProxy) RevokeLock(disconnect bool) (LockInfo, error) {
+	p.mu.Lock()
+
+	holder, held := p.clients[p.lockHolderID]
+	if !held {
+		p.lockHolderID = ""
+		p.mu.Unlock()
+		return LockInfo{}, ErrNoLockHolder
+	}
+
+	holderID := holder.ID
+	holder.Role = ClientRoleObserver
+	p.lockHolderID = ""
+	p.recordClientRoles()
+
+	info := p.lockInfo()
+	p.mu.Unlock()
+
+	slog.Info("Session lock revoked", logging.KeyClientID, holderID)
+
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventSessionLockRevoked,
+		SourceType: "proxy",
+		Timestamp:  time.Now(),
+		Params: map[string]interface{}{
+			"previous_holder_id": holderID,
+			"disconnect":         disconnect,
+		},
+	})
+
+	p.notifyLockChange(holderID, ClientRoleObserver, "", "revoked")
+	if disconnect {
+		p.closeClient(holderID, websocket.ClosePolicyViolation, "session lock revoked")
+	}
+
+	return info, nil
+}
+
+// lockInfo describes the lock. Callers must hold p.mu.
+func (p *CDPProxy) lockInfo() LockInfo {
+	info := LockInfo{Mode: p.lockMode}
+
+	if holder, held := p.clients[p.lockHolderID]; held {
+		info.Locked = true
+		info.Holder = holder.ToModel()
+	} else {
+		info.Mode, _ = ParseLockMode(string(p.config.LockMode))
+	}
+	return info
+}
+
+// notifyLockChange tells a client about its new role through a synthetic
+// BrowserMux.lockChanged event.
+func (p *CDPProxy) notifyLockChange(clientID string, role ClientRole, holderID, reason string) {
+	p.notifyClient(clientID, "BrowserMux.lockChanged", map[string]interface{}{
+		"role":     role,
+		"holderId": holderID,
+		"reason":   reason,
+	})
+}
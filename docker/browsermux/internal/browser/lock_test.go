@@ -0,0 +1,160 @@
+package browser
+
+import (
+	"errors"
+	"testing"
+)
+
+func admitTestClient(t *testing.T, proxy *CDPProxy, id string, mode LockMode) (ClientRole, error) {
+	t.Helper()
+
+	role, holder, err := proxy.admitClient(mode, "")
+	if err != nil {
+		return "", err
+	}
+
+	proxy.clients[id] = &Client{ID: id, Send: make(chan []byte, 1), Connected: true, Role: role}
+	if holder {
+		proxy.lockHolderID = id
+		proxy.lockMode = mode
+	}
+	return role, nil
+}
+
+func TestLockModes(t *testing.T) {
+	t.Run("Exclusive rejects a second client", func(t *testing.T) {
+		proxy := newRoutingTestProxy()
+
+		if _, err := admitTestClient(t, proxy, "a", LockModeExclusive); err != nil {
+			t.Fatalf("Expected first client to be admitted, got %v", err)
+		}
+		if _, err := admitTestClient(t, proxy, "b", LockModeExclusive); !errors.Is(err, ErrSessionLocked) {
+			t.Fatalf("Expected ErrSessionLocked, got %v", err)
+		}
+		if _, err := admitTestClient(t, proxy, "c", LockModeShared); !errors.Is(err, ErrSessionLocked) {
+			t.Fatalf("Expected shared client to be rejected by the exclusive holder, got %v", err)
+		}
+	})
+
+	t.Run("Shared admits many controllers", func(t *testing.T) {
+		proxy := newRoutingTestProxy()
+
+		for _, id := range []string{"a", "b", "c"} {
+			role, err := admitTestClient(t, proxy, id, LockModeShared)
+			if err != nil || role != ClientRoleController {
+				t.Fatalf("Expected %s to join as controller, got %q, %v", id, role, err)
+			}
+		}
+		if _, err := admitTestClient(t, proxy, "d", LockModeExclusive); !errors.Is(err, ErrSessionLocked) {
+			t.Fatalf("Expected exclusive client to be rejected while controllers are connected, got %v", err)
+		}
+	})
+
+	t.Run("Controller and observers", func(t *testing.T) {
+		proxy := newRoutingTestProxy()
+
+		if role, _ := admitTestClient(t, proxy, "a", LockModeControllerObservers); role != ClientRoleController {
+			t.Fatalf("Expected first client to be the controller, got %q", role)
+		}
+		for _, id := range []string{"b", "c"} {
+			if role, err := admitTestClient(t, proxy, id, LockModeControllerObservers); err != nil || role != ClientRoleObserver {
+				t.Fatalf("Expected %s to join as observer, got %q, %v", id, role, err)
+			}
+		}
+
+		delete(proxy.clients, "a")
+		if role, _ := admitTestClient(t, proxy, "d", LockModeControllerObservers); role != ClientRoleController {
+			t.Fatalf("Expected a new controller once the previous one left, got %q", role)
+		}
+	})
+}
+
+func TestLockModeOverride(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	metadata := map[string]interface{}{"lock_mode": "shared"}
+
+	if _, err := proxy.lockModeFor(metadata); !errors.Is(err, ErrLockModeOverrideDenied) {
+		t.Fatalf("Expected override to be denied by default, got %v", err)
+	}
+
+	proxy.config.AllowLockModeOverride = true
+	if mode, err := proxy.lockModeFor(metadata); err != nil || mode != LockModeShared {
+		t.Fatalf("Expected shared override, got %q, %v", mode, err)
+	}
+
+	if _, err := proxy.lockModeFor(map[string]interface{}{"lock_mode": "bogus"}); !errors.Is(err, ErrInvalidLockMode) {
+		t.Fatalf("Expected ErrInvalidLockMode, got %v", err)
+	}
+
+	if mode, err := proxy.lockModeFor(map[string]interface{}{}); err != nil || mode != LockModeExclusive {
+		t.Fatalf("Expected configured exclusive mode, got %q, %v", mode, err)
+	}
+}
+
+func TestLockHandoff(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	admitTestClient(t, proxy, "agent", LockModeControllerObservers)
+	admitTestClient(t, proxy, "operator", LockModeControllerObservers)
+
+	if info := proxy.GetLock(); !info.Locked || info.Holder.ID != "agent" || info.Mode != LockModeControllerObservers {
+		t.Fatalf("Expected agent to hold a controller+observers lock, got %+v", info)
+	}
+
+	t.Run("Transfer", func(t *testing.T) {
+		info, err := proxy.TransferLock("operator")
+		if err != nil {
+			t.Fatalf("TransferLock() error = %v", err)
+		}
+		if info.Holder.ID != "operator" || proxy.clients["operator"].Role != ClientRoleController {
+			t.Errorf("Expected operator to hold the lock, got %+v", info)
+		}
+		if proxy.clients["agent"].Role != ClientRoleObserver {
+			t.Errorf("Expected agent to be demoted to observer, got %q", proxy.clients["agent"].Role)
+		}
+
+		event := receiveMessage(t, proxy.clients["agent"])
+		if event.Method != "BrowserMux.lockChanged" || event.Params["role"] != "observer" {
+			t.Errorf("Expected agent to be notified of its demotion, got %+v", event)
+		}
+		if event := receiveMessage(t, proxy.clients["operator"]); event.Params["role"] != "controller" {
+			t.Errorf("Expected operator to be notified of its promotion, got %+v", event)
+		}
+
+		if !hasEvent(proxy, EventSessionLockTransferred) {
+			t.Error("Expected lock transfer event to be dispatched")
+		}
+	})
+
+	t.Run("Transfer to unknown client", func(t *testing.T) {
+		if _, err := proxy.TransferLock("nobody"); !errors.Is(err, ErrClientNotFound) {
+			t.Errorf("Expected ErrClientNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		info, err := proxy.RevokeLock(false)
+		if err != nil {
+			t.Fatalf("RevokeLock() error = %v", err)
+		}
+		if info.Locked || proxy.clients["operator"].Role != ClientRoleObserver {
+			t.Errorf("Expected lock to be released and operator demoted, got %+v", info)
+		}
+		receiveMessage(t, proxy.clients["operator"])
+
+		if _, err := proxy.RevokeLock(false); !errors.Is(err, ErrNoLockHolder) {
+			t.Errorf("Expected ErrNoLockHolder on second revoke, got %v", err)
+		}
+		if !hasEvent(proxy, EventSessionLockRevoked) {
+			t.Error("Expected lock revoke event to be dispatched")
+		}
+	})
+}
+
+func hasEvent(proxy *CDPProxy, eventType EventType) bool {
+	for _, event := range proxy.eventDispatcher.(*mockDispatcher).events {
+		if event.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package browser
+
+import (
+	"time"
+
+	"browsermux/internal/metrics"
+)
+
+// cdpMethodNotFound is the JSON-RPC code the browser answers unknown methods
+// with.
+const cdpMethodNotFound = -32601
+
+// recordClientRoles publishes the number of connected clients per role.
+// Callers must hold p.mu.
+func (p *CDPProxy) recordClientRoles() {
+	for _, role := range []ClientRole{ClientRoleController, ClientRoleObserver} {
+		metrics.ClientsConnected.WithLabelValues(p.Name(), string(role)).Set(float64(p.countClientsWithRole(role)))
+	}
+}
+
+// observeCommandDuration records how long the browser took to answer a
+// command, measured from when it was written upstream.
+func (p *CDPProxy) observeCommandDuration(cmd *pendingCommand, resp *CDPMessage) {
+	started := cmd.writtenAt
+	if started.IsZero() {
+		started = cmd.sentAt
+	}
+
+	method := metrics.MethodLabel(cmd.method)
+	if resp.Error != nil && resp.Error.Code == cdpMethodNotFound {
+		method = "other"
+	}
+	metrics.CommandDuration.WithLabelValues(p.Name(), method).Observe(time.Since(started).Seconds())
+}
@@ -0,0 +1,112 @@
+package browser
+
+import (
+	"fmt"
+)
+
+// cdpServerError is the JSON-RPC code the browser itself uses for commands it
+// refuses to run.
+const cdpServerError = -32000
+
+// DefaultObserverAllowedMethods are the commands observers may send. They read
+// browser state without changing it; the enables are reference-counted so they
+// never affect other clients.
+var DefaultObserverAllowedMethods = []string{
+	"Accessibility.enable",
+	"Accessibility.disable",
+	"Accessibility.getFullAXTree",
+	"Browser.getVersion",
+	"CSS.enable",
+	"CSS.disable",
+	"CSS.getComputedStyleForNode",
+	"DOM.enable",
+	"DOM.disable",
+	"DOM.describeNode",
+	"DOM.getAttributes",
+	"DOM.getBoxModel",
+	"DOM.getDocument",
+	"DOM.getOuterHTML",
+	"DOM.querySelector",
+	"DOM.querySelectorAll",
+	"DOM.requestChildNodes",
+	"Log.enable",
+	"Log.disable",
+	"Network.enable",
+	"Network.disable",
+	"Network.getResponseBody",
+	"Page.enable",
+	"Page.disable",
+	"Page.captureScreenshot",
+	"Page.getFrameTree",
+	"Page.getLayoutMetrics",
+	"Page.getNavigationHistory",
+	"Runtime.enable",
+	"Runtime.disable",
+	"Runtime.evaluate",
+	"Runtime.getProperties",
+	"Target.attachToTarget",
+	"Target.getTargetInfo",
+	"Target.getTargets",
+	"Target.setDiscoverTargets",
+}
+
+// sideEffectCheckedMethods may only be called by observers when the browser is
+// asked to abort on side effects.
+var sideEffectCheckedMethods = map[string]bool{
+	"Runtime.evaluate":       true,
+	"Runtime.callFunctionOn": true,
+}
+
+// observerMayCall reports whether an observer is allowed to send the command.
+// Allowlist entries are exact method names or patterns like "DOM.*".
+func (p *CDPProxy) observerMayCall(cdpMsg *CDPMessage) bool {
+	if !cdpMsg.IsCommand() {
+		return false
+	}
+
+	allowed := p.config.ObserverAllowedMethods
+	if allowed == nil {
+		allowed = DefaultObserverAllowedMethods
+	}
+
+	if !matchesMethodList(allowed, cdpMsg.Method) {
+		return false
+	}
+
+	if sideEffectCheckedMethods[cdpMsg.Method] {
+		throwOnSideEffect, _ := cdpMsg.Params["throwOnSideEffect"].(bool)
+		return throwOnSideEffect
+	}
+	return true
+}
+
+// rejectObserverCommand answers a command an observer is not allowed to send.
+func (p *CDPProxy) rejectObserverCommand(clientID string, cdpMsg *CDPMessage) {
+	if !cdpMsg.IsCommand() {
+		return
+	}
+
+	p.respond(clientID, cdpMsg, nil, &CDPError{
+		Code:    cdpServerError,
+		Message: fmt.Sprintf("'%s' is not allowed for observer clients", cdpMsg.Method),
+	})
+}
+
+func (p *CDPProxy) clientRole(clientID string) ClientRole {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if client, exists := p.clients[clientID]; exists {
+		return client.role()
+	}
+	return ClientRoleController
+}
+
+func matchesMethodList(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		if MatchesMethod(pattern, method) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package browser
+
+import "testing"
+
+func TestObserverCommands(t *testing.T) {
+	proxy := newRoutingTestProxy("observer")
+	proxy.clients["observer"].Role = ClientRoleObserver
+
+	t.Run("Mutating commands are rejected", func(t *testing.T) {
+		if _, ok := proxy.prepareClientMessage("observer", []byte(`{"id":4,"method":"Page.navigate","params":{"url":"https://example.com"}}`)); ok {
+			t.Fatal("Expected Page.navigate from an observer not to be forwarded")
+		}
+
+		response := receiveMessage(t, proxy.clients["observer"])
+		if response.ID != 4 || response.Error == nil || response.Error.Code != -32000 {
+			t.Errorf("Expected -32000 error for id 4, got %+v", response)
+		}
+	})
+
+	t.Run("Read-only commands are forwarded", func(t *testing.T) {
+		if _, ok := proxy.prepareClientMessage("observer", []byte(`{"id":5,"method":"DOM.getDocument","params":{}}`)); !ok {
+			t.Error("Expected DOM.getDocument to be forwarded")
+		}
+		expectNoMessage(t, proxy.clients["observer"])
+	})
+
+	t.Run("Runtime.evaluate requires side-effect-free mode", func(t *testing.T) {
+		if _, ok := proxy.prepareClientMessage("observer", []byte(`{"id":6,"method":"Runtime.evaluate","params":{"expression":"document.title"}}`)); ok {
+			t.Error("Expected Runtime.evaluate without throwOnSideEffect to be rejected")
+		}
+		receiveMessage(t, proxy.clients["observer"])
+
+		if _, ok := proxy.prepareClientMessage("observer", []byte(`{"id":7,"method":"Runtime.evaluate","params":{"expression":"document.title","throwOnSideEffect":true}}`)); !ok {
+			t.Error("Expected side-effect-free Runtime.evaluate to be forwarded")
+		}
+	})
+
+	t.Run("Custom allowlist", func(t *testing.T) {
+		proxy.config.ObserverAllowedMethods = []string{"Page.*"}
+		defer func() { proxy.config.ObserverAllowedMethods = nil }()
+
+		if _, ok := proxy.prepareClientMessage("observer", []byte(`{"id":8,"method":"Page.reload"}`)); !ok {
+			t.Error("Expected Page.reload to be allowed by the Page.* pattern")
+		}
+		if _, ok := proxy.prepareClientMessage("observer", []byte(`{"id":9,"method":"DOM.getDocument"}`)); ok {
+			t.Error("Expected DOM.getDocument to be rejected by the custom allowlist")
+		}
+	})
+
+	t.Run("Role is exposed in the client model", func(t *testing.T) {
+		if dto := proxy.clients["observer"].ToModel(); dto.Role != ClientRoleObserver {
+			t.Errorf("Expected observer role in DTO, got %q", dto.Role)
+		}
+	})
+}
@@ -3,19 +3,38 @@ package browser
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+
+	"browsermux/internal/logging"
+	"browsermux/internal/metrics"
 )
 
 var _ ClientManager = (*CDPProxy)(nil)
 var _ ConnectionManager = (*CDPProxy)(nil)
 var _ MessageHandler = (*CDPProxy)(nil)
 
-var ErrSessionLocked = errors.New("session locked by first attached client")
+var ErrSessionLocked = errors.New("session locked by another client")
+
+var ErrInvalidClientKeepalive = errors.New("client ping interval must be shorter than the pong wait")
+
+// DefaultBrowserName is the name of a proxy configured without one.
+const DefaultBrowserName = metrics.DefaultBrowser
+
+// browserDispatcher stamps the events of a named proxy with its name.
+type browserDispatcher struct {
+	EventDispatcher
+	browser string
+}
+
+func (d browserDispatcher) Dispatch(event Event) {
+	event.Browser = d.browser
+	d.EventDispatcher.Dispatch(event)
+}
 
 type CDPProxy struct {
 	browserConn     *websocket.Conn
@@ -26,13 +45,72 @@ type CDPProxy struct {
 	mu              sync.RWMutex
 	connected       bool
 	shutdown        chan struct{}
-	firstClientID   string
+	lockHolderID    string
+	lockMode        LockMode
+	commands        commandTracker
+	sessions        sessionTable
+	domains         domainTable
+	queue           commandQueue
+	flushRequests   chan struct{}
+	restoreMu       sync.Mutex
+	restore         *stateRestore
+	recorder        MessageRecorder
+	health          healthState
+	state           ConnectionState
 }
 
 type CDPProxyConfig struct {
-	BrowserURL        string
-	MaxMessageSize    int
-	ConnectionTimeout time.Duration
+	// Name identifies the browser when browsermux fronts several. Events from
+	// a named proxy carry it in Event.Browser; empty selects
+	// DefaultBrowserName.
+	Name                  string
+	BrowserURL            string
+	MaxMessageSize        int
+	ConnectionTimeout     time.Duration
+	LockMode              LockMode
+	AllowLockModeOverride bool
+	// ObserverAllowedMethods lists the commands observers may send. Nil selects
+	// DefaultObserverAllowedMethods.
+	ObserverAllowedMethods []string
+	SlowConsumerPolicy     SlowConsumerPolicy
+	SlowConsumerSampleRate int
+	// SampledEventMethods lists the events thinned out by the sample_events
+	// policy. Nil selects DefaultSampledEventMethods.
+	SampledEventMethods []string
+	// CommandQueueSize bounds the number of client messages held while the
+	// browser is disconnected; CommandQueueTimeout is how long each may wait.
+	CommandQueueSize    int
+	CommandQueueTimeout time.Duration
+	// CommandTimeout is how long the browser may take to answer a command; zero
+	// disables timeouts. CommandTimeouts overrides it per method, nil selects
+	// DefaultCommandTimeouts.
+	CommandTimeout  time.Duration
+	CommandTimeouts map[string]time.Duration
+	Reconnect       ReconnectPolicy
+	// KeepaliveInterval is how often the browser is probed with
+	// Browser.getVersion; zero disables probes and read deadlines.
+	// StallTimeout is how long a probe may go unanswered before the browser
+	// is considered stalled and the connection is dropped.
+	KeepaliveInterval time.Duration
+	StallTimeout      time.Duration
+	// RestoreTimeout bounds how long client traffic is held while state is
+	// restored after a reconnect. Zero selects the default.
+	RestoreTimeout time.Duration
+	// ClientPingInterval is how often clients are pinged, ClientPongWait how
+	// long a client may stay silent before it is dropped and ClientWriteWait
+	// how long a write to a client may block. Zero values select the
+	// defaults.
+	ClientPingInterval time.Duration
+	ClientPongWait     time.Duration
+	ClientWriteWait    time.Duration
+}
+
+// Name returns the configured browser name or DefaultBrowserName.
+func (p *CDPProxy) Name() string {
+	if p.config.Name == "" {
+		return DefaultBrowserName
+	}
+	return p.config.Name
 }
 
 func (p *CDPProxy) GetConfig() CDPProxyConfig {
@@ -41,89 +119,74 @@ func (p *CDPProxy) GetConfig() CDPProxyConfig {
 
 func DefaultConfig() CDPProxyConfig {
 	return CDPProxyConfig{
-		BrowserURL:        "ws://localhost:9222/devtools/browser",
-		MaxMessageSize:    4 * 1024 * 1024,
-		ConnectionTimeout: 10 * time.Second,
+		BrowserURL:          "ws://localhost:9222/devtools/browser",
+		MaxMessageSize:      4 * 1024 * 1024,
+		ConnectionTimeout:   10 * time.Second,
+		LockMode:            LockModeExclusive,
+		SlowConsumerPolicy:  SlowConsumerDropEvents,
+		CommandQueueSize:    defaultCommandQueueSize,
+		CommandQueueTimeout: defaultCommandQueueTimeout,
+		CommandTimeout:      defaultCommandTimeout,
+		KeepaliveInterval:   defaultKeepaliveInterval,
+		StallTimeout:        defaultStallTimeout,
+		RestoreTimeout:      defaultRestoreTimeout,
 	}
 }
 
 func NewCDPProxy(dispatcher EventDispatcher, config CDPProxyConfig) (*CDPProxy, error) {
+	if config.Name != "" {
+		dispatcher = browserDispatcher{EventDispatcher: dispatcher, browser: config.Name}
+	}
+
 	p := &CDPProxy{
 		clients:         make(map[string]*Client),
 		eventDispatcher: dispatcher,
 		config:          config,
 		browserMessages: make(chan []byte, 100),
 		shutdown:        make(chan struct{}),
+		flushRequests:   make(chan struct{}, 1),
+	}
+	// Pings at or beyond the pong wait would drop every healthy client.
+	if ping, pong := p.clientPingInterval(), p.clientPongWait(); ping >= pong {
+		return nil, fmt.Errorf("%w: ping interval %s, pong wait %s", ErrInvalidClientKeepalive, ping, pong)
 	}
 
+	p.commands.browser = p.Name()
+	metrics.RegisterBrowser(p.Name())
+
 	// Start connection retry logic in background instead of failing immediately
 	go p.connectWithRetry()
 
 	go p.processBrowserMessages()
 	go p.processClientMessages()
+	go p.keepalive()
 
 	return p, nil
 }
 
-// connectWithRetry continuously tries to connect to the browser until successful
+// connectWithRetry connects to the browser, retrying as the reconnect policy
+// says.
 func (p *CDPProxy) connectWithRetry() {
-	maxRetries := 30 // Try for up to 30 attempts
-	retryDelay := 2 * time.Second
-
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		select {
-		case <-p.shutdown:
-			return
-		default:
-		}
-
-		log.Printf("Attempting to connect to browser at %s (attempt %d/%d)", p.config.BrowserURL, attempt, maxRetries)
-
-		if err := p.Connect(); err != nil {
-			log.Printf("Failed to connect to browser (attempt %d/%d): %v", attempt, maxRetries, err)
-
-			if attempt == maxRetries {
-				log.Printf("Failed to connect to browser after %d attempts, will continue trying indefinitely", maxRetries)
-				// Continue trying indefinitely with longer delays
-				for {
-					select {
-					case <-p.shutdown:
-						return
-					default:
-					}
-
-					time.Sleep(5 * time.Second)
-					log.Printf("Retrying connection to browser at %s", p.config.BrowserURL)
-
-					if err := p.Connect(); err == nil {
-						log.Printf("Successfully connected to browser at %s", p.config.BrowserURL)
-						return
-					}
-				}
-			}
-
-			time.Sleep(retryDelay)
-			continue
-		}
-
-		log.Printf("Successfully connected to browser at %s", p.config.BrowserURL)
-		return
-	}
+	slog.Info("Connecting to browser", "browser_url", p.config.BrowserURL)
+	p.retryConnect(p.Connect)
 }
 
 func (p *CDPProxy) Connect() error {
-	log.Printf("Attempting to connect to browser at %s", p.config.BrowserURL)
+	slog.Debug("Fetching browser WebSocket URL", "browser_url", p.config.BrowserURL)
 	browserInfo, err := GetBrowserInfo(p.config.BrowserURL)
 	if err != nil {
 		return fmt.Errorf("failed to get browser info: %w", err)
 	}
 
 	actualBrowserURL := browserInfo.URL
-	log.Printf("Using browser WebSocket URL: %s (transformed from original endpoint)", actualBrowserURL)
+	slog.Debug("Using browser WebSocket URL", "ws_url", actualBrowserURL)
 
 	if err := p.connectToBrowser(actualBrowserURL); err != nil {
 		return fmt.Errorf("browser connection error: %w", err)
 	}
+
+	// Commands sent before the first connection was up are waiting in the queue.
+	p.signalQueueFlush()
 	return nil
 }
 
@@ -139,6 +202,7 @@ func (p *CDPProxy) Disconnect() error {
 	}
 
 	p.connected = false
+	metrics.BrowserConnected.WithLabelValues(p.Name()).Set(0)
 	return nil
 }
 
@@ -160,8 +224,12 @@ func (p *CDPProxy) HandleClientMessage(clientID string, message []byte) error {
 	}
 	p.mu.RUnlock()
 
-	if err := p.browserConn.WriteMessage(websocket.TextMessage, message); err != nil {
-		log.Printf("Error sending message to browser: %v", err)
+	message, ok := p.prepareClientMessage(clientID, message)
+	if !ok {
+		return nil
+	}
+
+	if err := p.writeToBrowser(p.browserConn, message); err != nil {
 		return fmt.Errorf("failed to send message to browser: %w", err)
 	}
 	return nil
@@ -173,7 +241,19 @@ func (p *CDPProxy) HandleBrowserMessage(message []byte) error {
 }
 
 func (p *CDPProxy) fanOut(message []byte) {
-	if cdpMsg, err := ParseCDPMessage(message); err == nil && cdpMsg.IsEvent() {
+	metrics.RecordMessage(p.Name(), metrics.DirectionBrowserToClient, len(message))
+
+	cdpMsg, err := ParseCDPMessage(message)
+	if err == nil {
+		message = p.fromUpstream(message, cdpMsg)
+	}
+
+	if err == nil && cdpMsg.IsResponse() {
+		p.routeResponse(cdpMsg, message)
+		return
+	}
+
+	if err == nil && cdpMsg.IsEvent() {
 		p.eventDispatcher.Dispatch(Event{
 			Type:       EventCDPEvent,
 			Method:     cdpMsg.Method,
@@ -181,17 +261,103 @@ func (p *CDPProxy) fanOut(message []byte) {
 			SourceType: "browser",
 			Timestamp:  time.Now(),
 		})
+
+		p.routeEvent(cdpMsg, message)
+		return
 	}
 
 	p.mu.RLock()
 	for _, client := range p.clients {
-		if client.Connected {
-			select {
-			case client.Send <- message:
-			default:
-				log.Printf("Client %s message buffer full, dropping message", client.ID)
-			}
+		p.deliver(client, message, "")
+	}
+	p.mu.RUnlock()
+}
+
+// routeEvent delivers session-scoped events to the client owning the session
+// and browser-level events to every client that is not bound to a page.
+func (p *CDPProxy) routeEvent(cdpMsg *CDPMessage, message []byte) {
+	switch cdpMsg.Method {
+	case "Target.attachedToTarget":
+		if internal := p.claimAttachedSession(cdpMsg); internal {
+			return
 		}
+	case "Target.detachedFromTarget":
+		defer p.handleTargetDetached(cdpMsg)
+
+		if sessionID, _ := cdpMsg.Params["sessionId"].(string); p.sessions.isPageSession(sessionID) {
+			return
+		}
+	}
+
+	if ownerID := p.eventOwner(cdpMsg); ownerID != "" {
+		p.deliverTo(ownerID, cdpMsg.SessionID, message, cdpMsg.Method)
+		return
+	}
+
+	var subscribers []string
+	if domain := eventDomain(cdpMsg.Method); domain != "" {
+		subscribers = p.domains.subscribers(domainKey{sessionID: cdpMsg.SessionID, domain: domain})
+	}
+
+	p.mu.RLock()
+	for _, client := range p.clients {
+		if p.sessions.isPageClient(client.ID) {
+			continue
+		}
+		if len(subscribers) > 0 && indexOf(subscribers, client.ID) == -1 {
+			continue
+		}
+		p.deliver(client, message, cdpMsg.Method)
+	}
+	p.mu.RUnlock()
+}
+
+// routeResponse hands a command response back to the client that issued the
+// command, restoring the client's original command ID.
+func (p *CDPProxy) routeResponse(cdpMsg *CDPMessage, message []byte) {
+	cmd, ok := p.commands.resolve(cdpMsg.ID)
+	if !ok {
+		slog.Debug("Dropping response for unknown or timed out command", logging.KeyCDPID, cdpMsg.ID, logging.KeySessionID, cdpMsg.SessionID)
+		metrics.RecordDrop(p.Name(), metrics.DropLateResponse)
+		return
+	}
+
+	p.observeCommandDuration(cmd, cdpMsg)
+
+	if cmd.callback != nil {
+		cmd.callback(cdpMsg)
+		return
+	}
+
+	if isAttachCommand(cmd.method) && cdpMsg.Error == nil {
+		p.claimSessionFromResult(cmd, cdpMsg.Result)
+	}
+
+	if cdpMsg.Error != nil {
+		if domain, enable, ok := domainToggle(&CDPMessage{Method: cmd.method}); ok && enable {
+			p.domains.release(domainKey{sessionID: cmd.sessionID, domain: domain}, cmd.clientID)
+		}
+	}
+
+	restored, err := setMessageField(message, "id", cmd.originalID)
+	if err != nil {
+		slog.Error("Error restoring command id", logging.KeyClientID, cmd.clientID, logging.KeyMethod, cmd.method, logging.KeyCDPID, cmd.originalID, "error", err)
+		return
+	}
+
+	p.deliverTo(cmd.clientID, cdpMsg.SessionID, restored, "")
+}
+
+// deliverTo queues a message for a single client. Messages on a page client's
+// own session are stripped of the sessionId the proxy added on its behalf.
+func (p *CDPProxy) deliverTo(clientID, sessionID string, message []byte, eventMethod string) {
+	if sessionID != "" && sessionID == p.sessions.pageSession(clientID) {
+		message = stripSessionID(message)
+	}
+
+	p.mu.RLock()
+	if client, exists := p.clients[clientID]; exists {
+		p.deliver(client, message, eventMethod)
 	}
 	p.mu.RUnlock()
 }
@@ -206,34 +372,51 @@ func (p *CDPProxy) connectToBrowser(browserURL string) error {
 		return fmt.Errorf("websocket connection error: %w", err)
 	}
 
+	conn.SetReadLimit(int64(p.config.MaxMessageSize))
+	p.mu.Lock()
 	p.browserConn = conn
 	p.connected = true
-	p.browserConn.SetReadLimit(int64(p.config.MaxMessageSize))
+	p.mu.Unlock()
+	metrics.BrowserConnected.WithLabelValues(p.Name()).Set(1)
 
-	log.Printf("Connected to browser at %s", browserURL)
+	slog.Info("Connected to browser", "ws_url", browserURL)
 	return nil
 }
 
 func (p *CDPProxy) AddClient(conn *websocket.Conn, metadata map[string]interface{}) (string, error) {
+	mode, err := p.lockModeFor(metadata)
+	if err != nil {
+		return "", err
+	}
+
 	clientID := uuid.New().String()
 	client := NewClient(clientID, conn, p.eventDispatcher, p, metadata)
+	client.traceCtx = traceContextFrom(metadata)
+
+	requested, _ := metadata["role"].(string)
 
 	p.mu.Lock()
-	if p.firstClientID != "" {
-		if _, exists := p.clients[p.firstClientID]; exists {
-			p.mu.Unlock()
-			return "", ErrSessionLocked
-		}
-		p.firstClientID = ""
+	role, holder, err := p.admitClient(mode, ClientRole(requested))
+	if err != nil {
+		p.mu.Unlock()
+		return "", err
 	}
 
-	if p.firstClientID == "" {
-		p.firstClientID = clientID
+	client.Role = role
+	if holder {
+		p.lockHolderID = clientID
+		p.lockMode = mode
 	}
 
 	p.clients[clientID] = client
+	p.recordClientRoles()
 	p.mu.Unlock()
 
+	targetID, _ := metadata["target_id"].(string)
+	if targetID != "" {
+		p.sessions.bindPage(clientID, targetID)
+	}
+
 	p.eventDispatcher.Dispatch(Event{
 		Type:       EventClientConnected,
 		SourceID:   clientID,
@@ -242,29 +425,66 @@ func (p *CDPProxy) AddClient(conn *websocket.Conn, metadata map[string]interface
 		Params: map[string]interface{}{
 			"client_id": clientID,
 			"metadata":  metadata,
+			"role":      role,
+			"lock_mode": mode,
 		},
 	})
 
 	go p.handleClientMessages(client)
 	go p.sendMessagesToClient(client)
 
+	if targetID != "" {
+		if err := p.attachPageClient(clientID, targetID); err != nil {
+			slog.Warn("Failed to attach client to target", logging.KeyClientID, clientID, logging.KeyTargetID, targetID, "error", err)
+		}
+	}
+
 	return clientID, nil
 }
 
 func (p *CDPProxy) RemoveClient(clientID string) error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 
 	client, exists := p.clients[clientID]
 	if !exists {
+		p.mu.Unlock()
 		return fmt.Errorf("client %s not found", clientID)
 	}
 
 	close(client.Send)
 	delete(p.clients, clientID)
+	client.spans.endAll("client disconnected")
+	p.commands.dropClient(clientID)
 
-	if clientID == p.firstClientID {
-		p.firstClientID = ""
+	if clientID == p.lockHolderID {
+		p.lockHolderID = ""
+	}
+
+	remaining := len(p.clients)
+	p.recordClientRoles()
+	p.mu.Unlock()
+
+	sessions := p.sessions.dropClient(clientID)
+	var released []domainKey
+	for _, key := range p.domains.dropClient(clientID) {
+		if key.sessionID == "" || indexOf(sessions, key.sessionID) == -1 {
+			released = append(released, key)
+		}
+	}
+
+	if len(sessions) > 0 || len(released) > 0 {
+		go func() {
+			p.disableDomains(released)
+			p.detachSessions(sessions)
+		}()
+	}
+
+	params := map[string]interface{}{
+		"client_id": clientID,
+	}
+	if info := client.stats.disconnect.Load(); info != nil {
+		params["code"] = info.code
+		params["reason"] = info.reason
 	}
 
 	p.eventDispatcher.Dispatch(Event{
@@ -272,12 +492,10 @@ func (p *CDPProxy) RemoveClient(clientID string) error {
 		SourceID:   clientID,
 		SourceType: "client",
 		Timestamp:  time.Now(),
-		Params: map[string]interface{}{
-			"client_id": clientID,
-		},
+		Params:     params,
 	})
 
-	log.Printf("Removed client %s, remaining clients: %d", clientID, len(p.clients))
+	client.logger().Info("Removed client", "remaining_clients", remaining)
 	return nil
 }
 
@@ -293,11 +511,58 @@ func (p *CDPProxy) GetClients() []*ClientDTO {
 
 	clients := make([]*ClientDTO, 0, len(p.clients))
 	for _, client := range p.clients {
-		clients = append(clients, client.ToModel())
+		clients = append(clients, p.clientModel(client))
 	}
 	return clients
 }
 
+// GetClient returns the details of a connected client.
+func (p *CDPProxy) GetClient(clientID string) (*ClientDTO, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	client, exists := p.clients[clientID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+	return p.clientModel(client), nil
+}
+
+// clientModel adds what the proxy tracks about a client to its model.
+func (p *CDPProxy) clientModel(client *Client) *ClientDTO {
+	model := client.ToModel()
+	model.InFlightCommands = p.commands.countForClient(client.ID)
+	model.SessionIDs, model.TargetIDs = p.sessions.ownedBy(client.ID)
+	return model
+}
+
+// SetClientTrace turns full message logging for a client on or off.
+func (p *CDPProxy) SetClientTrace(clientID string, enabled bool) error {
+	p.mu.RLock()
+	client, exists := p.clients[clientID]
+	p.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrClientNotFound, clientID)
+	}
+
+	client.stats.trace.Store(enabled)
+	client.logger().Info("Protocol trace toggled", "enabled", enabled)
+	return nil
+}
+
+// SetRecorder hands every message relayed to and from clients to recorder.
+// It must be called before clients connect.
+func (p *CDPProxy) SetRecorder(recorder MessageRecorder) {
+	p.recorder = recorder
+}
+
+func (p *CDPProxy) recordMessage(direction, clientID string, message []byte) {
+	if p.recorder != nil {
+		p.recorder.RecordMessage(direction, clientID, message)
+	}
+}
+
 func (p *CDPProxy) Shutdown() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -318,8 +583,10 @@ func (p *CDPProxy) Shutdown() error {
 		}
 		delete(p.clients, clientID)
 	}
+	p.recordClientRoles()
+	metrics.BrowserConnected.WithLabelValues(p.Name()).Set(0)
 
-	log.Println("CDP Proxy shutdown complete")
+	slog.Info("CDP Proxy shutdown complete")
 	return nil
 }
 
@@ -330,16 +597,38 @@ func (p *CDPProxy) handleClientMessages(client *Client) {
 
 	client.Conn.SetReadLimit(int64(p.config.MaxMessageSize))
 
+	// A client that answers neither pings nor anything else within pongWait
+	// is gone, even if its TCP connection still looks open.
+	pongWait := p.clientPongWait()
+	client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.Conn.SetPongHandler(func(string) error {
+		return client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
 	for {
 		_, message, err := client.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("Client %s error: %v", client.ID, err)
+				client.logger().Warn("Client connection error", "error", err)
 			}
+			client.setDisconnectReason(readErrorReason(err))
 			break
 		}
+		client.Conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		metrics.RecordMessage(p.Name(), metrics.DirectionClientToBrowser, len(message))
+		client.traceMessage(metrics.DirectionClientToBrowser, message)
+		p.recordMessage(metrics.DirectionClientToBrowser, client.ID, message)
 
-		if cdpMsg, err := ParseCDPMessage(message); err == nil && cdpMsg.IsCommand() {
+		var method string
+		cdpMsg, err := ParseCDPMessage(message)
+		if err == nil && cdpMsg.IsCommand() {
+			method = cdpMsg.Method
+		}
+		client.stats.recordReceived(len(message), method)
+
+		if method != "" {
+			p.startCommandSpan(client, cdpMsg)
 			p.eventDispatcher.Dispatch(Event{
 				Type:       EventCDPCommand,
 				Method:     cdpMsg.Method,
@@ -350,8 +639,13 @@ func (p *CDPProxy) handleClientMessages(client *Client) {
 			})
 		}
 
+		forwarded, ok := p.prepareClientMessage(client.ID, message)
+		if !ok {
+			continue
+		}
+
 		select {
-		case p.browserMessages <- message:
+		case p.browserMessages <- forwarded:
 		case <-p.shutdown:
 			return
 		}
@@ -359,7 +653,7 @@ func (p *CDPProxy) handleClientMessages(client *Client) {
 }
 
 func (p *CDPProxy) sendMessagesToClient(client *Client) {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(p.clientPingInterval())
 	defer ticker.Stop()
 
 	for {
@@ -369,13 +663,19 @@ func (p *CDPProxy) sendMessagesToClient(client *Client) {
 				return
 			}
 
-			if err := client.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("Error sending message to client %s: %v", client.ID, err)
+			if err := p.writeToClient(client, websocket.TextMessage, message); err != nil {
+				client.logger().Warn("Error sending message to client", "error", err)
+				p.dropClientConn(client, err)
 				return
 			}
+			client.stats.recordSent(len(message))
+			client.traceMessage(metrics.DirectionBrowserToClient, message)
+			p.recordMessage(metrics.DirectionBrowserToClient, client.ID, message)
+			client.endCommandSpan(message)
 		case <-ticker.C:
-			if err := client.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("Error sending ping to client %s: %v", client.ID, err)
+			if err := p.writeToClient(client, websocket.PingMessage, nil); err != nil {
+				client.logger().Warn("Error sending ping to client", "error", err)
+				p.dropClientConn(client, err)
 				return
 			}
 		case <-p.shutdown:
@@ -384,10 +684,23 @@ func (p *CDPProxy) sendMessagesToClient(client *Client) {
 	}
 }
 
+// writeToClient writes a message that must be accepted within writeWait.
+func (p *CDPProxy) writeToClient(client *Client, messageType int, data []byte) error {
+	client.Conn.SetWriteDeadline(time.Now().Add(p.clientWriteWait()))
+	return client.Conn.WriteMessage(messageType, data)
+}
+
+// dropClientConn closes the connection of a client that could not be written
+// to. The read loop then fails and removes the client.
+func (p *CDPProxy) dropClientConn(client *Client, err error) {
+	client.setDisconnectReason(writeErrorReason(err))
+	client.Conn.Close()
+}
+
 func (p *CDPProxy) processBrowserMessages() {
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Recovered in processBrowserMessages: %v", r)
+			slog.Error("Recovered in processBrowserMessages", "panic", r)
 		}
 	}()
 
@@ -410,16 +723,36 @@ func (p *CDPProxy) processBrowserMessages() {
 			continue
 		}
 
+		if timeout := p.readTimeout(); timeout > 0 {
+			browserConn.SetReadDeadline(time.Now().Add(timeout))
+		}
+
 		_, message, err := browserConn.ReadMessage()
 		if err != nil {
-			log.Printf("Error reading from browser: %v", err)
+			select {
+			case <-p.shutdown:
+				return
+			default:
+			}
 
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				if err := p.reconnectToBrowser(); err != nil {
-					log.Printf("Failed to reconnect to browser: %v", err)
-					time.Sleep(5 * time.Second)
-				}
+			if isTimeout(err) {
+				p.markStalled(browserConn, fmt.Sprintf("no message from browser for %s", p.readTimeout()))
+			}
+			if p.State() == StateStalled {
+				err = ErrBrowserStalled
+			}
+			slog.Warn("Error reading from browser", "error", err)
+
+			p.mu.RLock()
+			replaced := p.browserConn != browserConn
+			p.mu.RUnlock()
+			if replaced {
+				// Disconnect was called or someone else already reconnected.
+				continue
 			}
+
+			p.handleBrowserDisconnect(err)
+			p.reconnectUntilConnected()
 			continue
 		}
 
@@ -427,35 +760,63 @@ func (p *CDPProxy) processBrowserMessages() {
 	}
 }
 
+// reconnectUntilConnected redials the browser as the reconnect policy says
+// until it is back, the policy gives up or the proxy shuts down.
+func (p *CDPProxy) reconnectUntilConnected() {
+	if p.retryConnect(p.reconnectToBrowser) {
+		p.handleBrowserReconnected()
+	}
+}
+
+// processClientMessages is the only writer on the browser connection. While
+// the browser is unreachable messages are held in the command queue and
+// replayed in order once it is back.
 func (p *CDPProxy) processClientMessages() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case message := <-p.browserMessages:
-			// Wait for browser connection to be established
-			p.mu.RLock()
-			connected := p.connected
-			browserConn := p.browserConn
-			p.mu.RUnlock()
-
-			if !connected || browserConn == nil {
-				// Browser not connected, drop the message
-				log.Printf("Dropping client message - browser not connected")
-				continue
-			}
-
-			if err := browserConn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("Error sending message to browser: %v", err)
-
-				if err := p.reconnectToBrowser(); err != nil {
-					log.Printf("Failed to reconnect to browser: %v", err)
-				}
+			p.writeOrHold(message)
+		case <-p.flushRequests:
+			if browserConn, ok := p.upstream(); ok && !p.restoring() {
+				p.flushQueue(browserConn)
 			}
+		case <-ticker.C:
+			p.expireQueuedMessages()
+			p.expireCommands()
 		case <-p.shutdown:
 			return
 		}
 	}
 }
 
+func (p *CDPProxy) writeOrHold(message []byte) {
+	browserConn, ok := p.upstream()
+	if ok && p.restoring() {
+		// Client traffic waits until the previous session state is back.
+		if !p.commands.passesHold(commandID(message)) {
+			p.holdMessage(message)
+			return
+		}
+	} else if !ok || !p.flushQueue(browserConn) {
+		p.holdMessage(message)
+		return
+	}
+
+	if err := p.writeToBrowser(browserConn, message); err != nil {
+		p.holdMessage(message)
+	}
+}
+
+func (p *CDPProxy) upstream() (*websocket.Conn, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.browserConn, p.connected && p.browserConn != nil
+}
+
 func (p *CDPProxy) reconnectToBrowser() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -464,15 +825,16 @@ func (p *CDPProxy) reconnectToBrowser() error {
 		p.browserConn.Close()
 	}
 
-	log.Printf("Attempting to reconnect to browser at %s", p.config.BrowserURL)
+	slog.Info("Attempting to reconnect to browser", "browser_url", p.config.BrowserURL)
 	browserInfo, err := GetBrowserInfo(p.config.BrowserURL)
 	if err != nil {
 		p.connected = false
+		metrics.ReconnectAttempts.WithLabelValues(p.Name(), "failure").Inc()
 		return fmt.Errorf("failed to get browser info for reconnection: %w", err)
 	}
 
 	actualBrowserURL := browserInfo.URL
-	log.Printf("Reconnecting using WebSocket URL: %s (transformed from original endpoint)", actualBrowserURL)
+	slog.Debug("Reconnecting using browser WebSocket URL", "ws_url", actualBrowserURL)
 
 	dialer := websocket.Dialer{
 		HandshakeTimeout: p.config.ConnectionTimeout,
@@ -481,12 +843,15 @@ func (p *CDPProxy) reconnectToBrowser() error {
 	p.browserConn, _, err = dialer.Dial(actualBrowserURL, nil)
 	if err != nil {
 		p.connected = false
+		metrics.ReconnectAttempts.WithLabelValues(p.Name(), "failure").Inc()
 		return fmt.Errorf("failed to reconnect to browser: %w", err)
 	}
 
 	p.connected = true
 	p.browserConn.SetReadLimit(int64(p.config.MaxMessageSize))
+	metrics.ReconnectAttempts.WithLabelValues(p.Name(), "success").Inc()
+	metrics.BrowserConnected.WithLabelValues(p.Name()).Set(1)
 
-	log.Printf("Reconnected to browser at %s", actualBrowserURL)
+	slog.Info("Reconnected to browser", "ws_url", actualBrowserURL)
 	return nil
 }
@@ -0,0 +1,264 @@
+package browser
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/logging"
+	"browsermux/internal/metrics"
+)
+
+const (
+	defaultCommandQueueSize    = 100
+	defaultCommandQueueTimeout = 30 * time.Second
+)
+
+// queuedMessage is a client message held back while the browser is
+// unreachable. proxyID is the rewritten command ID, or 0 for non-commands.
+type queuedMessage struct {
+	data     []byte
+	proxyID  int
+	deadline time.Time
+}
+
+// commandQueue holds messages that could not be written upstream until the
+// browser connection is back.
+type commandQueue struct {
+	mu    sync.Mutex
+	items []queuedMessage
+}
+
+func (q *commandQueue) push(item queuedMessage, limit int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.items) >= limit {
+		return false
+	}
+	q.items = append(q.items, item)
+	return true
+}
+
+// expire removes and returns the messages whose deadline has passed.
+func (q *commandQueue) expire(now time.Time) []queuedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var expired []queuedMessage
+	kept := q.items[:0]
+	for _, item := range q.items {
+		if now.After(item.deadline) {
+			expired = append(expired, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	q.items = kept
+	return expired
+}
+
+func (q *commandQueue) drain() []queuedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.items
+	q.items = nil
+	return items
+}
+
+// requeue puts messages that could not be flushed back in front of the queue.
+func (q *commandQueue) requeue(items []queuedMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = append(items, q.items...)
+}
+
+func (q *commandQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.items)
+}
+
+// holdMessage queues a message while the browser is unreachable. Commands that
+// do not fit are answered with an error right away.
+func (p *CDPProxy) holdMessage(message []byte) {
+	limit := p.config.CommandQueueSize
+	if limit <= 0 {
+		limit = defaultCommandQueueSize
+	}
+	timeout := p.config.CommandQueueTimeout
+	if timeout <= 0 {
+		timeout = defaultCommandQueueTimeout
+	}
+
+	item := queuedMessage{
+		data:     message,
+		proxyID:  commandID(message),
+		deadline: time.Now().Add(timeout),
+	}
+
+	if !p.queue.push(item, limit) {
+		slog.Warn("Command queue full, rejecting message while browser is disconnected", logging.KeyCDPID, item.proxyID)
+		metrics.RecordDrop(p.Name(), metrics.DropCommandQueueFull)
+		p.failPending(item.proxyID, "Browser not connected and command queue is full")
+	}
+}
+
+func (p *CDPProxy) expireQueuedMessages() {
+	for _, item := range p.queue.expire(time.Now()) {
+		metrics.RecordDrop(p.Name(), metrics.DropCommandQueueExpired)
+		p.failPending(item.proxyID, "Browser not connected")
+	}
+}
+
+// flushQueue writes held messages upstream in order. It must only be called
+// from processClientMessages, which owns writes to the browser connection.
+func (p *CDPProxy) flushQueue(browserConn *websocket.Conn) bool {
+	items := p.queue.drain()
+	for i, item := range items {
+		if item.proxyID != 0 && !p.commands.isPending(item.proxyID) {
+			// The client went away while its command was queued.
+			continue
+		}
+		if err := p.writeToBrowser(browserConn, item.data); err != nil {
+			p.queue.requeue(items[i:])
+			return false
+		}
+	}
+	if len(items) > 0 {
+		slog.Info("Replayed queued messages to browser", "count", len(items))
+	}
+	return true
+}
+
+func (p *CDPProxy) writeToBrowser(browserConn *websocket.Conn, message []byte) error {
+	if err := browserConn.WriteMessage(websocket.TextMessage, p.toUpstream(message)); err != nil {
+		slog.Error("Error sending message to browser", "error", err)
+		// Closing the connection wakes up processBrowserMessages, which owns
+		// reconnecting.
+		browserConn.Close()
+		return err
+	}
+
+	if id := commandID(message); id != 0 {
+		p.commands.markWritten(id, time.Now())
+	}
+	return nil
+}
+
+// failPending answers a tracked command with a CDP error instead of a browser
+// response.
+func (p *CDPProxy) failPending(proxyID int, reason string) {
+	if proxyID == 0 {
+		return
+	}
+
+	if cmd, ok := p.commands.resolve(proxyID); ok {
+		p.failCommand(proxyID, cmd, reason)
+	}
+}
+
+func (p *CDPProxy) failCommand(proxyID int, cmd *pendingCommand, reason string) {
+	cdpErr := &CDPError{Code: cdpServerError, Message: reason}
+
+	if cmd.callback != nil {
+		cmd.callback(&CDPMessage{ID: proxyID, Error: cdpErr, SessionID: cmd.sessionID})
+		return
+	}
+
+	if domain, enable, ok := domainToggle(&CDPMessage{Method: cmd.method}); ok && enable {
+		p.domains.release(domainKey{sessionID: cmd.sessionID, domain: domain}, cmd.clientID)
+	}
+
+	p.respond(cmd.clientID, &CDPMessage{ID: cmd.originalID, SessionID: cmd.sessionID}, nil, cdpErr)
+}
+
+// handleBrowserDisconnect marks the browser as gone, fails the commands it will
+// never answer and tells clients about it.
+func (p *CDPProxy) handleBrowserDisconnect(cause error) {
+	p.mu.Lock()
+	wasConnected := p.connected
+	p.connected = false
+	p.mu.Unlock()
+	metrics.BrowserConnected.WithLabelValues(p.Name()).Set(0)
+	p.health.recordError(cause)
+
+	if !wasConnected {
+		return
+	}
+
+	p.restoreMu.Lock()
+	p.restore = nil
+	p.restoreMu.Unlock()
+
+	for proxyID, cmd := range p.commands.takeWritten() {
+		p.failCommand(proxyID, cmd, "Browser connection lost")
+	}
+
+	reason := ""
+	if cause != nil {
+		reason = cause.Error()
+	}
+
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventBrowserDisconnected,
+		SourceType: "browser",
+		Timestamp:  time.Now(),
+		Params: map[string]interface{}{
+			"reason": reason,
+		},
+	})
+	p.notifyAllClients("BrowserMux.browserDisconnected", map[string]interface{}{
+		"reason": reason,
+	})
+}
+
+// handleBrowserReconnected tells clients the browser is back, re-establishes
+// their state and then lets the writer replay held messages.
+func (p *CDPProxy) handleBrowserReconnected() {
+	p.health.recordReconnect()
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventBrowserReconnected,
+		SourceType: "browser",
+		Timestamp:  time.Now(),
+	})
+	p.notifyAllClients("BrowserMux.browserReconnected", map[string]interface{}{})
+	p.restoreState()
+}
+
+func (p *CDPProxy) signalQueueFlush() {
+	select {
+	case p.flushRequests <- struct{}{}:
+	default:
+	}
+}
+
+func (p *CDPProxy) notifyAllClients(method string, params map[string]interface{}) {
+	p.mu.RLock()
+	clientIDs := make([]string, 0, len(p.clients))
+	for clientID := range p.clients {
+		clientIDs = append(clientIDs, clientID)
+	}
+	p.mu.RUnlock()
+
+	for _, clientID := range clientIDs {
+		p.notifyClient(clientID, method, params)
+	}
+}
+
+// commandID extracts the command ID of a raw message, or 0 if it has none.
+func commandID(message []byte) int {
+	var msg struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return 0
+	}
+	return msg.ID
+}
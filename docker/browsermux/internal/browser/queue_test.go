@@ -0,0 +1,139 @@
+package browser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func queueClientCommand(t *testing.T, proxy *CDPProxy, clientID string, command string) {
+	t.Helper()
+
+	forwarded, ok := proxy.prepareClientMessage(clientID, []byte(command))
+	if !ok {
+		t.Fatalf("Command %s was not forwarded", command)
+	}
+	proxy.holdMessage(forwarded)
+}
+
+func TestCommandQueueDeadline(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	proxy.connected = false
+	proxy.config.CommandQueueTimeout = time.Millisecond
+	client := proxy.clients["a"]
+
+	queueClientCommand(t, proxy, "a", `{"id":7,"method":"Page.navigate","params":{"url":"about:blank"}}`)
+	if proxy.queue.len() != 1 {
+		t.Fatalf("Expected 1 queued message, got %d", proxy.queue.len())
+	}
+	expectNoMessage(t, client)
+
+	time.Sleep(5 * time.Millisecond)
+	proxy.expireQueuedMessages()
+
+	resp := receiveMessage(t, client)
+	if resp.ID != 7 || resp.Error == nil || resp.Error.Code != cdpServerError {
+		t.Errorf("Expected error response for id 7, got %+v", resp)
+	}
+	if proxy.queue.len() != 0 {
+		t.Errorf("Expected expired message to leave the queue, %d left", proxy.queue.len())
+	}
+	if count := proxy.commands.countForClient("a"); count != 0 {
+		t.Errorf("Expected expired command to be forgotten, %d still pending", count)
+	}
+}
+
+func TestCommandQueueFull(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	proxy.connected = false
+	proxy.config.CommandQueueSize = 1
+	client := proxy.clients["a"]
+
+	queueClientCommand(t, proxy, "a", `{"id":1,"method":"Page.reload"}`)
+	queueClientCommand(t, proxy, "a", `{"id":2,"method":"Page.reload"}`)
+
+	resp := receiveMessage(t, client)
+	if resp.ID != 2 || resp.Error == nil {
+		t.Errorf("Expected the overflowing command to be rejected, got %+v", resp)
+	}
+	if proxy.queue.len() != 1 {
+		t.Errorf("Expected 1 queued message, got %d", proxy.queue.len())
+	}
+}
+
+func TestCommandQueueReplay(t *testing.T) {
+	server := createMockBrowserServer(t, `
+{"direction":"client_to_browser","client_id":"rec","payload":{"id":1,"method":"Page.reload"}}
+{"direction":"browser_to_client","client_id":"rec","payload":{"id":1,"result":{"step":"reload"}}}
+{"direction":"client_to_browser","client_id":"rec","payload":{"id":2,"method":"Page.stopLoading"}}
+{"direction":"browser_to_client","client_id":"rec","payload":{"id":2,"result":{"step":"stop"}}}
+`)
+	defer server.Close()
+
+	proxy := newRoutingTestProxy("a")
+	proxy.connected = false
+
+	queueClientCommand(t, proxy, "a", `{"id":1,"method":"Page.reload"}`)
+	queueClientCommand(t, proxy, "a", `{"id":2,"method":"Page.stopLoading"}`)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/devtools/browser", nil)
+	if err != nil {
+		t.Fatalf("Failed to dial mock browser: %v", err)
+	}
+	defer conn.Close()
+
+	if !proxy.flushQueue(conn) {
+		t.Fatal("Expected queued messages to be flushed")
+	}
+
+	for _, step := range []string{"reload", "stop"} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, response, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read response: %v", err)
+		}
+		if !strings.Contains(string(response), `"step":"`+step+`"`) {
+			t.Errorf("Expected the %s response next, got %s", step, response)
+		}
+	}
+}
+
+func TestBrowserDisconnectFailsInFlightCommands(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	client := proxy.clients["a"]
+
+	forwarded, _ := proxy.prepareClientMessage("a", []byte(`{"id":3,"method":"Runtime.evaluate","params":{"expression":"1"}}`))
+	proxy.commands.markWritten(commandID(forwarded), time.Now())
+	queueClientCommand(t, proxy, "a", `{"id":4,"method":"Page.reload"}`)
+
+	proxy.handleBrowserDisconnect(errors.New("connection reset"))
+
+	resp := receiveMessage(t, client)
+	if resp.ID != 3 || resp.Error == nil {
+		t.Errorf("Expected in-flight command 3 to fail, got %+v", resp)
+	}
+
+	event := receiveMessage(t, client)
+	if event.Method != "BrowserMux.browserDisconnected" || event.Params["reason"] != "connection reset" {
+		t.Errorf("Expected disconnect notification, got %+v", event)
+	}
+	expectNoMessage(t, client)
+
+	if proxy.IsConnected() {
+		t.Error("Expected proxy to be marked disconnected")
+	}
+	if !hasEvent(proxy, EventBrowserDisconnected) {
+		t.Error("Expected browser.disconnected event to be dispatched")
+	}
+	if proxy.queue.len() != 1 {
+		t.Errorf("Expected queued command to survive the disconnect, got %d", proxy.queue.len())
+	}
+
+	proxy.handleBrowserReconnected()
+	if event := receiveMessage(t, client); event.Method != "BrowserMux.browserReconnected" {
+		t.Errorf("Expected reconnect notification, got %+v", event)
+	}
+}
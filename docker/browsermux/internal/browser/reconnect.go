@@ -0,0 +1,196 @@
+package browser
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"os"
+	"time"
+)
+
+// ConnectionState is where the proxy stands with the upstream browser.
+type ConnectionState string
+
+const (
+	StateConnecting ConnectionState = "connecting"
+	StateConnected  ConnectionState = "connected"
+	// StateBackingOff waits out the reconnect delay after a failed attempt.
+	StateBackingOff ConnectionState = "backing_off"
+	// StateFailed means the reconnect policy gave up.
+	StateFailed ConnectionState = "failed"
+	// StateStalled means the browser stopped answering; the connection is
+	// dropped and reconnected.
+	StateStalled ConnectionState = "stalled"
+)
+
+// GiveUpAction decides what happens once MaxAttempts connection attempts in a
+// row have failed.
+type GiveUpAction string
+
+const (
+	// GiveUpFail stops retrying and leaves the proxy in StateFailed.
+	GiveUpFail GiveUpAction = "fail"
+	// GiveUpExit exits the process with status 1, so a supervisor can restart
+	// the browser together with the proxy.
+	GiveUpExit GiveUpAction = "exit"
+)
+
+// ParseGiveUpAction validates an action name. An empty name selects
+// GiveUpFail.
+func ParseGiveUpAction(action string) (GiveUpAction, error) {
+	switch GiveUpAction(action) {
+	case "":
+		return GiveUpFail, nil
+	case GiveUpFail, GiveUpExit:
+		return GiveUpAction(action), nil
+	}
+	return "", fmt.Errorf("invalid reconnect give-up action %q", action)
+}
+
+// ReconnectPolicy controls how the proxy (re)connects to the browser. The
+// delay before attempt n+1 is InitialDelay*Multiplier^(n-1), capped at
+// MaxDelay and spread by up to ±Jitter of itself. Zero values select the
+// defaults; a negative Jitter disables it and MaxAttempts zero retries
+// forever.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+	MaxAttempts  int
+	GiveUp       GiveUpAction
+}
+
+const (
+	defaultReconnectInitialDelay = time.Second
+	defaultReconnectMaxDelay     = 30 * time.Second
+	defaultReconnectMultiplier   = 2
+	defaultReconnectJitter       = 0.2
+)
+
+// exitProcess is replaced in tests.
+var exitProcess = os.Exit
+
+func (r ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if r.InitialDelay <= 0 {
+		r.InitialDelay = defaultReconnectInitialDelay
+	}
+	if r.MaxDelay <= 0 {
+		r.MaxDelay = defaultReconnectMaxDelay
+	}
+	if r.MaxDelay < r.InitialDelay {
+		r.MaxDelay = r.InitialDelay
+	}
+	if r.Multiplier < 1 {
+		r.Multiplier = defaultReconnectMultiplier
+	}
+	if r.Jitter < 0 {
+		r.Jitter = 0
+	} else if r.Jitter == 0 {
+		r.Jitter = defaultReconnectJitter
+	} else if r.Jitter > 1 {
+		r.Jitter = 1
+	}
+	if r.GiveUp == "" {
+		r.GiveUp = GiveUpFail
+	}
+	return r
+}
+
+// Delay returns the wait after the given failed attempt, counted from 1.
+func (r ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := float64(r.InitialDelay) * math.Pow(r.Multiplier, float64(attempt-1))
+	delay = min(delay, float64(r.MaxDelay))
+	delay *= 1 + r.Jitter*(2*rand.Float64()-1)
+	return time.Duration(delay)
+}
+
+// State returns the current connection state.
+func (p *CDPProxy) State() ConnectionState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.state == "" {
+		return StateConnecting
+	}
+	return p.state
+}
+
+// setState records a state change and reports it as a browser.state_changed
+// event. details are added to the event params.
+func (p *CDPProxy) setState(state ConnectionState, details map[string]interface{}) {
+	p.mu.Lock()
+	previous := p.state
+	p.state = state
+	p.mu.Unlock()
+
+	if previous != state {
+		p.dispatchStateChange(state, previous, details)
+	}
+}
+
+func (p *CDPProxy) dispatchStateChange(state, previous ConnectionState, details map[string]interface{}) {
+	params := map[string]interface{}{
+		"state":    string(state),
+		"previous": string(previous),
+	}
+	for key, value := range details {
+		params[key] = value
+	}
+
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventBrowserStateChanged,
+		SourceType: "browser",
+		Timestamp:  time.Now(),
+		Params:     params,
+	})
+}
+
+// retryConnect calls connect until it succeeds, waiting between attempts as
+// the reconnect policy says. It returns false if the proxy shut down or the
+// policy gave up.
+func (p *CDPProxy) retryConnect(connect func() error) bool {
+	policy := p.config.Reconnect.withDefaults()
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-p.shutdown:
+			return false
+		default:
+		}
+
+		p.setState(StateConnecting, map[string]interface{}{"attempt": attempt})
+
+		err := connect()
+		if err == nil {
+			slog.Info("Successfully connected to browser", "browser_url", p.config.BrowserURL, "attempt", attempt)
+			p.setState(StateConnected, map[string]interface{}{"attempt": attempt})
+			return true
+		}
+		p.health.recordError(err)
+
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			slog.Error("Giving up connecting to browser", "browser_url", p.config.BrowserURL, "attempts", attempt, "action", policy.GiveUp, "error", err)
+			p.setState(StateFailed, map[string]interface{}{"attempt": attempt, "error": err.Error()})
+			if policy.GiveUp == GiveUpExit {
+				exitProcess(1)
+			}
+			return false
+		}
+
+		delay := policy.Delay(attempt)
+		slog.Warn("Failed to connect to browser", "attempt", attempt, "max_attempts", policy.MaxAttempts, "retry_in", delay, "error", err)
+		p.setState(StateBackingOff, map[string]interface{}{
+			"attempt":  attempt,
+			"delay_ms": delay.Milliseconds(),
+			"error":    err.Error(),
+		})
+
+		select {
+		case <-p.shutdown:
+			return false
+		case <-time.After(delay):
+		}
+	}
+}
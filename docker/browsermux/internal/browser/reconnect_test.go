@@ -0,0 +1,103 @@
+package browser
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialDelay: 100 * time.Millisecond,
+		MaxDelay:     time.Second,
+		Multiplier:   2,
+		Jitter:       -1,
+	}.withDefaults()
+
+	for attempt, expected := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		10: time.Second,
+	} {
+		if got := policy.Delay(attempt); got != expected {
+			t.Errorf("Delay(%d) = %v, want %v", attempt, got, expected)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.Delay(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("Delay(1) with 50%% jitter = %v, want 50ms..150ms", got)
+		}
+	}
+
+	defaults := ReconnectPolicy{}.withDefaults()
+	if defaults.InitialDelay != time.Second || defaults.MaxDelay != 30*time.Second || defaults.GiveUp != GiveUpFail {
+		t.Errorf("Unexpected defaults %+v", defaults)
+	}
+
+	if _, err := ParseGiveUpAction("restart"); err == nil {
+		t.Error("Expected an error for an unknown give-up action")
+	}
+}
+
+func TestRetryConnect(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	proxy.config.Reconnect = ReconnectPolicy{InitialDelay: time.Millisecond, Jitter: -1}
+
+	failures := 2
+	connected := proxy.retryConnect(func() error {
+		if failures > 0 {
+			failures--
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	if !connected || proxy.State() != StateConnected {
+		t.Fatalf("Expected to connect on the third attempt, state %s", proxy.State())
+	}
+
+	var states []string
+	for _, event := range proxy.eventDispatcher.(*mockDispatcher).events {
+		if event.Type == EventBrowserStateChanged {
+			states = append(states, event.Params["state"].(string))
+		}
+	}
+	expected := []string{"connecting", "backing_off", "connecting", "backing_off", "connecting", "connected"}
+	if len(states) != len(expected) {
+		t.Fatalf("Expected states %v, got %v", expected, states)
+	}
+	for i := range expected {
+		if states[i] != expected[i] {
+			t.Errorf("State %d: got %s, want %s", i, states[i], expected[i])
+		}
+	}
+}
+
+func TestRetryConnectGivesUp(t *testing.T) {
+	previous := exitProcess
+	exitCode := -1
+	exitProcess = func(code int) { exitCode = code }
+	defer func() { exitProcess = previous }()
+
+	proxy := newRoutingTestProxy()
+	proxy.config.Reconnect = ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 3, GiveUp: GiveUpExit}
+
+	attempts := 0
+	connected := proxy.retryConnect(func() error {
+		attempts++
+		return errors.New("connection refused")
+	})
+
+	if connected || attempts != 3 {
+		t.Errorf("Expected to give up after 3 attempts, got %d", attempts)
+	}
+	if proxy.State() != StateFailed || exitCode != 1 {
+		t.Errorf("Expected state failed and exit code 1, got %s and %d", proxy.State(), exitCode)
+	}
+	if health := proxy.Health(); health.LastError != "connection refused" {
+		t.Errorf("Expected the last attempt's error, got %q", health.LastError)
+	}
+}
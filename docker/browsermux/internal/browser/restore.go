@@ -0,0 +1,364 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const defaultRestoreTimeout = 10 * time.Second
+
+// restoreItem is a piece of client state the proxy tried to re-establish after
+// a reconnect.
+type restoreItem struct {
+	Method    string `json:"method"`
+	SessionID string `json:"session_id,omitempty"`
+	TargetID  string `json:"target_id,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// stateRestore collects the outcome of re-issuing client state. outstanding
+// counts the re-issued commands still waiting for a response.
+type stateRestore struct {
+	mu          sync.Mutex
+	outstanding int
+	restored    []restoreItem
+	failed      []restoreItem
+	// deadline ends the restore if the browser leaves commands unanswered;
+	// completed makes sure it ends only once.
+	deadline  *time.Timer
+	completed bool
+}
+
+func (r *stateRestore) begin() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.outstanding++
+}
+
+// finish records the outcome of a re-issued command and reports whether it was
+// the last one.
+func (r *stateRestore) finish(item restoreItem) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if item.Error != "" {
+		r.failed = append(r.failed, item)
+	} else if item.Method != "" {
+		r.restored = append(r.restored, item)
+	}
+	r.outstanding--
+	return r.outstanding == 0
+}
+
+func (r *stateRestore) fail(item restoreItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failed = append(r.failed, item)
+}
+
+// complete reports whether the restore just ended, and false if it had
+// already.
+func (r *stateRestore) complete() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.completed {
+		return false
+	}
+	r.completed = true
+	if r.deadline != nil {
+		r.deadline.Stop()
+	}
+	return true
+}
+
+// restoreState re-issues the domain enables, Target toggles and explicit
+// attaches clients made on the previous browser connection. Client traffic is
+// held until every re-issued command has been answered.
+func (p *CDPProxy) restoreState() {
+	enables := p.domains.snapshot()
+	explicit, auto := p.sessions.restorable()
+
+	if len(enables) == 0 && len(explicit) == 0 && len(auto) == 0 {
+		p.signalQueueFlush()
+		return
+	}
+
+	r := &stateRestore{}
+	p.restoreMu.Lock()
+	p.restore = r
+	p.restoreMu.Unlock()
+
+	r.mu.Lock()
+	r.deadline = time.AfterFunc(p.restoreTimeout(), func() { p.expireRestore(r) })
+	r.mu.Unlock()
+
+	// Held until every command below has been issued, so that early responses
+	// cannot complete the restore.
+	r.begin()
+
+	bySession := make(map[string]map[domainKey]domainEnable)
+	for key, enable := range enables {
+		if bySession[key.sessionID] == nil {
+			bySession[key.sessionID] = make(map[domainKey]domainEnable)
+		}
+		bySession[key.sessionID][key] = enable
+	}
+
+	// Auto-attached sessions come back on their own once auto-attach is
+	// re-enabled, under new IDs.
+	for _, session := range auto {
+		p.forgetSession(session)
+		r.fail(restoreItem{
+			Method:    "Target.attachedToTarget",
+			SessionID: session.sessionID,
+			ClientID:  session.clientID,
+			Error:     "auto-attached session is re-announced by the browser",
+		})
+	}
+
+	for key, enable := range bySession[""] {
+		p.replayEnable(r, key, enable)
+	}
+	delete(bySession, "")
+
+	for _, session := range explicit {
+		p.reattachSession(r, session, bySession[session.sessionID])
+		delete(bySession, session.sessionID)
+	}
+
+	for _, orphaned := range bySession {
+		for key, enable := range orphaned {
+			r.fail(restoreItem{Method: enable.method, SessionID: key.sessionID, Error: "session was not restored"})
+		}
+	}
+
+	p.finishRestoreItem(r, restoreItem{}, nil)
+}
+
+func (p *CDPProxy) replayEnable(r *stateRestore, key domainKey, enable domainEnable) {
+	item := restoreItem{Method: enable.method, SessionID: key.sessionID}
+
+	r.begin()
+	err := p.sendRestoreCommand(key.sessionID, enable.method, enable.params, func(resp *CDPMessage) {
+		p.finishRestoreItem(r, item, resp.Error)
+	})
+	if err != nil {
+		p.finishRestoreItem(r, item, &CDPError{Code: cdpServerError, Message: err.Error()})
+	}
+}
+
+// reattachSession opens a new session to the target and aliases it to the ID
+// the client knows, then replays the domains enabled on the old session.
+func (p *CDPProxy) reattachSession(r *stateRestore, session attachedSession, enables map[domainKey]domainEnable) {
+	method := "Target.attachToTarget"
+	params := map[string]interface{}{
+		"targetId": session.targetID,
+		"flatten":  true,
+	}
+	if session.targetID == "" {
+		method = "Target.attachToBrowserTarget"
+		params = nil
+	}
+
+	item := restoreItem{
+		Method:    method,
+		SessionID: session.sessionID,
+		TargetID:  session.targetID,
+		ClientID:  session.clientID,
+	}
+
+	onFailure := func(cdpErr *CDPError) {
+		p.forgetSession(session)
+		for key, enable := range enables {
+			r.fail(restoreItem{Method: enable.method, SessionID: key.sessionID, Error: "session was not restored"})
+		}
+		p.finishRestoreItem(r, item, cdpErr)
+	}
+
+	r.begin()
+	err := p.sendRestoreCommand("", method, params, func(resp *CDPMessage) {
+		if resp.Error != nil {
+			onFailure(resp.Error)
+			return
+		}
+
+		var result struct {
+			SessionID string `json:"sessionId"`
+		}
+		if err := json.Unmarshal(resp.Result, &result); err != nil || result.SessionID == "" {
+			onFailure(&CDPError{Code: cdpServerError, Message: "invalid attach response"})
+			return
+		}
+
+		p.sessions.alias(session.sessionID, result.SessionID)
+		for key, enable := range enables {
+			p.replayEnable(r, key, enable)
+		}
+		p.finishRestoreItem(r, item, nil)
+	})
+	if err != nil {
+		onFailure(&CDPError{Code: cdpServerError, Message: err.Error()})
+	}
+}
+
+func (p *CDPProxy) sendRestoreCommand(sessionID, method string, params map[string]interface{}, onResponse func(*CDPMessage)) error {
+	targetID, _ := params["targetId"].(string)
+	_, err := p.sendTrackedCommand(&pendingCommand{
+		method:    method,
+		sessionID: sessionID,
+		targetID:  targetID,
+		sentAt:    time.Now(),
+		callback:  onResponse,
+		restore:   true,
+	}, params)
+	return err
+}
+
+func (p *CDPProxy) finishRestoreItem(r *stateRestore, item restoreItem, cdpErr *CDPError) {
+	if cdpErr != nil {
+		item.Error = cdpErr.Message
+	}
+	if r.finish(item) {
+		p.completeRestore(r)
+	}
+}
+
+func (p *CDPProxy) restoreTimeout() time.Duration {
+	if p.config.RestoreTimeout <= 0 {
+		return defaultRestoreTimeout
+	}
+	return p.config.RestoreTimeout
+}
+
+// expireRestore fails the restore commands the browser has not answered
+// within the restore timeout and releases the held client traffic.
+func (p *CDPProxy) expireRestore(r *stateRestore) {
+	p.restoreMu.Lock()
+	current := p.restore == r
+	p.restoreMu.Unlock()
+	if !current {
+		return
+	}
+
+	reason := fmt.Sprintf("not answered within %s", p.restoreTimeout())
+	slog.Warn("Restoring browser state timed out", "timeout", p.restoreTimeout())
+	for proxyID, cmd := range p.commands.takeRestore() {
+		p.failCommand(proxyID, cmd, reason)
+	}
+
+	// Failing the commands normally completes the restore; this gives up on
+	// anything that is still outstanding.
+	p.completeRestore(r)
+}
+
+func (p *CDPProxy) completeRestore(r *stateRestore) {
+	if !r.complete() {
+		return
+	}
+
+	p.restoreMu.Lock()
+	if p.restore == r {
+		p.restore = nil
+	}
+	p.restoreMu.Unlock()
+
+	slog.Info("Restored browser state after reconnect", "restored", len(r.restored), "failed", len(r.failed))
+
+	p.eventDispatcher.Dispatch(Event{
+		Type:       EventBrowserStateRestored,
+		SourceType: "proxy",
+		Timestamp:  time.Now(),
+		Params: map[string]interface{}{
+			"restored": r.restored,
+			"failed":   r.failed,
+		},
+	})
+
+	p.signalQueueFlush()
+}
+
+func (p *CDPProxy) restoring() bool {
+	p.restoreMu.Lock()
+	defer p.restoreMu.Unlock()
+
+	return p.restore != nil
+}
+
+// forgetSession tells the owner that a session did not survive the reconnect,
+// the same way the browser announces a detach.
+func (p *CDPProxy) forgetSession(session attachedSession) {
+	if !p.sessions.isPageSession(session.sessionID) {
+		params := map[string]interface{}{"sessionId": session.sessionID}
+		if session.targetID != "" {
+			params["targetId"] = session.targetID
+		}
+		p.notifyClient(session.clientID, "Target.detachedFromTarget", params)
+	}
+
+	p.handleTargetDetached(&CDPMessage{
+		Method: "Target.detachedFromTarget",
+		Params: map[string]interface{}{"sessionId": session.sessionID},
+	})
+}
+
+// Target methods whose params name a session rather than their own sessionId.
+var sessionParamMethods = map[string]bool{
+	"Target.detachFromTarget":          true,
+	"Target.sendMessageToTarget":       true,
+	"Target.detachedFromTarget":        true,
+	"Target.receivedMessageFromTarget": true,
+}
+
+// translateSessionIDs rewrites the session IDs of a message with lookup. It
+// updates cdpMsg to match.
+func translateSessionIDs(message []byte, cdpMsg *CDPMessage, lookup func(string) string) []byte {
+	if cdpMsg.SessionID != "" {
+		if translated := lookup(cdpMsg.SessionID); translated != cdpMsg.SessionID {
+			if rewritten, err := setMessageField(message, "sessionId", translated); err == nil {
+				message = rewritten
+				cdpMsg.SessionID = translated
+			}
+		}
+	}
+
+	if sessionParamMethods[cdpMsg.Method] {
+		if sessionID, _ := cdpMsg.Params["sessionId"].(string); sessionID != "" {
+			if translated := lookup(sessionID); translated != sessionID {
+				if rewritten, err := setParamField(message, "sessionId", translated); err == nil {
+					message = rewritten
+					cdpMsg.Params["sessionId"] = translated
+				}
+			}
+		}
+	}
+	return message
+}
+
+// toUpstream translates the session IDs clients know into the IDs of the
+// sessions re-opened after a reconnect.
+func (p *CDPProxy) toUpstream(message []byte) []byte {
+	if !p.sessions.hasAliases() {
+		return message
+	}
+
+	cdpMsg, err := ParseCDPMessage(message)
+	if err != nil {
+		return message
+	}
+	return translateSessionIDs(message, cdpMsg, p.sessions.upstreamID)
+}
+
+// fromUpstream translates re-opened session IDs back into the IDs clients know.
+func (p *CDPProxy) fromUpstream(message []byte, cdpMsg *CDPMessage) []byte {
+	if !p.sessions.hasAliases() {
+		return message
+	}
+	return translateSessionIDs(message, cdpMsg, p.sessions.clientSessionID)
+}
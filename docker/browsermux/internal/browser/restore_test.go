@@ -0,0 +1,199 @@
+package browser
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// setUpRestorableClient attaches client "a" to target T1 as session S1 and
+// enables Network on the browser session and Page on S1.
+func setUpRestorableClient(t *testing.T, proxy *CDPProxy) {
+	t.Helper()
+
+	for _, command := range []string{
+		`{"id":1,"method":"Network.enable","params":{"maxPostDataSize":1024}}`,
+		`{"id":2,"method":"Target.attachToTarget","params":{"targetId":"T1","flatten":true}}`,
+		`{"id":3,"method":"Page.enable","sessionId":"S1"}`,
+	} {
+		forwarded, ok := proxy.prepareClientMessage("a", []byte(command))
+		if !ok {
+			t.Fatalf("Command %s was not forwarded", command)
+		}
+
+		upstream, _ := ParseCDPMessage(forwarded)
+		result := `{}`
+		if upstream.Method == "Target.attachToTarget" {
+			result = `{"sessionId":"S1"}`
+		}
+		proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":%s}`, upstream.ID, result)))
+		receiveMessage(t, proxy.clients["a"])
+	}
+}
+
+func restoreEvent(t *testing.T, proxy *CDPProxy) Event {
+	t.Helper()
+
+	for _, event := range proxy.eventDispatcher.(*mockDispatcher).events {
+		if event.Type == EventBrowserStateRestored {
+			return event
+		}
+	}
+	t.Fatal("Expected browser.state_restored event")
+	return Event{}
+}
+
+func TestStateRestoreAfterReconnect(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	client := proxy.clients["a"]
+	setUpRestorableClient(t, proxy)
+
+	proxy.restoreState()
+	if !proxy.restoring() {
+		t.Fatal("Expected client traffic to be held while restoring")
+	}
+
+	var attachID int
+	for i := 0; i < 2; i++ {
+		msg := readBrowserMessage(t, proxy)
+		switch msg.Method {
+		case "Network.enable":
+			if msg.Params["maxPostDataSize"] != float64(1024) {
+				t.Errorf("Expected Network.enable params to be replayed, got %v", msg.Params)
+			}
+			proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{}}`, msg.ID)))
+		case "Target.attachToTarget":
+			if msg.Params["targetId"] != "T1" {
+				t.Errorf("Expected re-attach to T1, got %v", msg.Params)
+			}
+			attachID = msg.ID
+		default:
+			t.Fatalf("Unexpected restore command %s", msg.Method)
+		}
+	}
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"sessionId":"S2"}}`, attachID)))
+
+	raw := <-proxy.browserMessages
+	pageEnable, _ := ParseCDPMessage(proxy.toUpstream(raw))
+	if pageEnable.Method != "Page.enable" || pageEnable.SessionID != "S2" {
+		t.Fatalf("Expected Page.enable on the new session S2, got %+v", pageEnable)
+	}
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"sessionId":"S2","result":{}}`, pageEnable.ID)))
+
+	expectNoMessage(t, client)
+	if proxy.restoring() {
+		t.Error("Expected restore to be complete")
+	}
+
+	event := restoreEvent(t, proxy)
+	if restored := event.Params["restored"].([]restoreItem); len(restored) != 3 {
+		t.Errorf("Expected 3 restored items, got %+v", restored)
+	}
+	if failed := event.Params["failed"].([]restoreItem); len(failed) != 0 {
+		t.Errorf("Expected nothing to fail, got %+v", failed)
+	}
+
+	proxy.HandleBrowserMessage([]byte(`{"method":"Page.loadEventFired","sessionId":"S2","params":{"timestamp":1}}`))
+	if msg := receiveMessage(t, client); msg.Method != "Page.loadEventFired" || msg.SessionID != "S1" {
+		t.Errorf("Expected event on the client's session S1, got %+v", msg)
+	}
+}
+
+func TestStateRestoreTargetGone(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	client := proxy.clients["a"]
+	setUpRestorableClient(t, proxy)
+
+	proxy.restoreState()
+
+	for i := 0; i < 2; i++ {
+		msg := readBrowserMessage(t, proxy)
+		if msg.Method == "Target.attachToTarget" {
+			proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"error":{"code":-32602,"message":"No target with given id found"}}`, msg.ID)))
+		} else {
+			proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{}}`, msg.ID)))
+		}
+	}
+
+	detached := receiveMessage(t, client)
+	if detached.Method != "Target.detachedFromTarget" || detached.Params["sessionId"] != "S1" {
+		t.Errorf("Expected synthetic detach of S1, got %+v", detached)
+	}
+	if owner := proxy.sessions.owner("S1"); owner != "" {
+		t.Errorf("Expected S1 to be forgotten, still owned by %s", owner)
+	}
+
+	select {
+	case raw := <-proxy.browserMessages:
+		t.Errorf("Expected nothing to be replayed on a lost session, got %s", raw)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	failed := restoreEvent(t, proxy).Params["failed"].([]restoreItem)
+	if len(failed) != 2 {
+		t.Fatalf("Expected the attach and Page.enable to fail, got %+v", failed)
+	}
+}
+
+// restoredDispatcher records events like mockDispatcher and closes restored
+// once the restore is reported.
+type restoredDispatcher struct {
+	mockDispatcher
+	restored chan struct{}
+}
+
+func (d *restoredDispatcher) Dispatch(event Event) {
+	d.mockDispatcher.Dispatch(event)
+	if event.Type == EventBrowserStateRestored {
+		close(d.restored)
+	}
+}
+
+func TestStateRestoreDeadline(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	setUpRestorableClient(t, proxy)
+
+	dispatcher := &restoredDispatcher{restored: make(chan struct{})}
+	proxy.eventDispatcher = dispatcher
+
+	// Without command timeouts only the restore deadline ends the restore.
+	proxy.config.CommandTimeout = 0
+	proxy.config.RestoreTimeout = 50 * time.Millisecond
+	proxy.restoreState()
+
+	for i := 0; i < 2; i++ {
+		readBrowserMessage(t, proxy)
+	}
+
+	// Probes are not held behind the restore.
+	go proxy.Ping(context.Background())
+	probe := readBrowserMessage(t, proxy)
+	if probe.Method != "Browser.getVersion" || !proxy.commands.passesHold(probe.ID) {
+		t.Errorf("Expected the probe to pass held traffic, got %+v", probe)
+	}
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{}}`, probe.ID)))
+
+	select {
+	case <-dispatcher.restored:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the restore deadline to end the restore")
+	}
+	if proxy.restoring() {
+		t.Error("Expected client traffic to be released")
+	}
+
+	var failed []restoreItem
+	for _, event := range dispatcher.events {
+		if event.Type == EventBrowserStateRestored {
+			failed = event.Params["failed"].([]restoreItem)
+		}
+	}
+	if len(failed) != 3 {
+		t.Errorf("Expected Network.enable, the attach and Page.enable to fail, got %+v", failed)
+	}
+	if pending := len(proxy.commands.pending); pending != 0 {
+		t.Errorf("Expected the unanswered restore commands to leave the tracker, %d pending", pending)
+	}
+}
@@ -0,0 +1,426 @@
+package browser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"browsermux/internal/logging"
+	"browsermux/internal/metrics"
+)
+
+// pendingCommand is a command that was forwarded to the browser under a
+// proxy-assigned ID and is still waiting for its response. Commands issued by
+// the proxy itself have no client and hand their response to callback instead.
+type pendingCommand struct {
+	clientID   string
+	originalID int
+	method     string
+	sessionID  string
+	targetID   string
+	sentAt     time.Time
+	callback   func(*CDPMessage)
+	// writtenAt is set once the command has actually been sent upstream, as
+	// opposed to waiting in the command queue.
+	writtenAt time.Time
+	// restore marks commands re-issued after a reconnect, which may pass while
+	// client traffic is still held.
+	restore bool
+	// probe marks pings, which pass the held traffic as well so that a browser
+	// that stalls during a restore is still noticed.
+	probe bool
+	// awaitPromise marks commands that wait for a page promise to settle,
+	// which may take as long as the page likes.
+	awaitPromise bool
+}
+
+// commandTracker hands out proxy-unique command IDs so that commands from
+// different clients never collide on the shared browser connection, and
+// remembers which client each in-flight command belongs to.
+type commandTracker struct {
+	mu      sync.Mutex
+	lastID  int
+	pending map[int]*pendingCommand
+	// browser labels the in-flight gauge; empty means the default browser.
+	browser string
+}
+
+func (t *commandTracker) inFlight() prometheus.Gauge {
+	if t.browser == "" {
+		return metrics.InFlightCommands.WithLabelValues(DefaultBrowserName)
+	}
+	return metrics.InFlightCommands.WithLabelValues(t.browser)
+}
+
+func (t *commandTracker) track(cmd *pendingCommand) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[int]*pendingCommand)
+	}
+
+	for {
+		t.lastID++
+		if t.lastID <= 0 {
+			t.lastID = 1
+		}
+		if _, taken := t.pending[t.lastID]; !taken {
+			break
+		}
+	}
+
+	t.pending[t.lastID] = cmd
+	t.inFlight().Inc()
+	return t.lastID
+}
+
+// resolve removes and returns the command registered under the proxy ID.
+func (t *commandTracker) resolve(id int) (*pendingCommand, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cmd, ok := t.pending[id]
+	if ok {
+		delete(t.pending, id)
+		t.inFlight().Dec()
+	}
+	return cmd, ok
+}
+
+// dropClient forgets every in-flight command of the client, so late responses
+// for it are discarded instead of being delivered to someone else.
+func (t *commandTracker) dropClient(clientID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	dropped := 0
+	for id, cmd := range t.pending {
+		if cmd.clientID == clientID {
+			delete(t.pending, id)
+			dropped++
+		}
+	}
+	t.inFlight().Sub(float64(dropped))
+	return dropped
+}
+
+func (t *commandTracker) isPending(id int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.pending[id]
+	return ok
+}
+
+// passesHold reports whether the command may be written while client traffic
+// is held for a restore.
+func (t *commandTracker) passesHold(id int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cmd, ok := t.pending[id]
+	return ok && (cmd.restore || cmd.probe)
+}
+
+// takeRestore removes and returns the re-issued restore commands, written or
+// still queued.
+func (t *commandTracker) takeRestore() map[int]*pendingCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	taken := make(map[int]*pendingCommand)
+	for id, cmd := range t.pending {
+		if cmd.restore {
+			taken[id] = cmd
+			delete(t.pending, id)
+		}
+	}
+	t.inFlight().Sub(float64(len(taken)))
+	return taken
+}
+
+func (t *commandTracker) markWritten(id int, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cmd, ok := t.pending[id]; ok {
+		cmd.writtenAt = now
+	}
+}
+
+// takeWritten removes and returns every command already sent upstream. After a
+// lost connection their responses will never arrive.
+func (t *commandTracker) takeWritten() map[int]*pendingCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	written := make(map[int]*pendingCommand)
+	for id, cmd := range t.pending {
+		if !cmd.writtenAt.IsZero() {
+			written[id] = cmd
+			delete(t.pending, id)
+		}
+	}
+	t.inFlight().Sub(float64(len(written)))
+	return written
+}
+
+// expire removes and returns the commands the browser did not answer within
+// their timeout. A zero timeout never expires.
+func (t *commandTracker) expire(now time.Time, timeoutFor func(cmd *pendingCommand) time.Duration) map[int]*pendingCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expired := make(map[int]*pendingCommand)
+	for id, cmd := range t.pending {
+		if cmd.writtenAt.IsZero() {
+			continue
+		}
+		if timeout := timeoutFor(cmd); timeout > 0 && now.Sub(cmd.writtenAt) >= timeout {
+			expired[id] = cmd
+			delete(t.pending, id)
+		}
+	}
+	t.inFlight().Sub(float64(len(expired)))
+	return expired
+}
+
+// findAttach returns the in-flight Target.attachToTarget command for the target.
+func (t *commandTracker) findAttach(targetID string) (pendingCommand, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, cmd := range t.pending {
+		if cmd.method == "Target.attachToTarget" && cmd.targetID == targetID {
+			return *cmd, true
+		}
+	}
+	return pendingCommand{}, false
+}
+
+func (t *commandTracker) countForClient(clientID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	count := 0
+	for _, cmd := range t.pending {
+		if cmd.clientID == clientID {
+			count++
+		}
+	}
+	return count
+}
+
+// setMessageField rewrites a single top-level field of a raw CDP message while
+// leaving every other field byte-for-byte intact. A nil value removes the field.
+func setMessageField(message []byte, field string, value interface{}) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		delete(fields, field)
+	} else {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		fields[field] = encoded
+	}
+
+	return json.Marshal(fields)
+}
+
+// setParamField rewrites a single field of a raw CDP message's params.
+func setParamField(message []byte, field string, value interface{}) ([]byte, error) {
+	var msg struct {
+		Params map[string]json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Params == nil {
+		msg.Params = make(map[string]json.RawMessage)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	msg.Params[field] = encoded
+
+	return setMessageField(message, "params", msg.Params)
+}
+
+// prepareClientMessage turns a raw client message into the message that has to
+// be written upstream. It returns false when nothing should be forwarded yet.
+func (p *CDPProxy) prepareClientMessage(clientID string, message []byte) ([]byte, bool) {
+	cdpMsg, err := ParseCDPMessage(message)
+	observer := p.clientRole(clientID) == ClientRoleObserver
+	if err != nil {
+		return message, !observer
+	}
+
+	if observer && !p.observerMayCall(cdpMsg) {
+		p.rejectObserverCommand(clientID, cdpMsg)
+		return nil, false
+	}
+
+	sessionID, bound, held := p.sessions.routePageMessage(clientID, message)
+	if held {
+		return nil, false
+	}
+
+	if bound && cdpMsg.SessionID == "" {
+		withSession, err := setMessageField(message, "sessionId", sessionID)
+		if err != nil {
+			slog.Error("Error adding session to message", logging.KeyClientID, clientID, logging.KeySessionID, sessionID, "error", err)
+			return nil, false
+		}
+		message = withSession
+		cdpMsg.SessionID = sessionID
+	}
+
+	if domain, enable, ok := domainToggle(cdpMsg); ok && cdpMsg.IsCommand() {
+		if !p.applyDomainToggle(clientID, cdpMsg, domain, enable) {
+			return nil, false
+		}
+	}
+
+	return p.rewriteClientCommand(clientID, cdpMsg, message), true
+}
+
+// rewriteClientCommand replaces the client's command ID with a proxy-unique one
+// and records the original so the response can be routed back to the client.
+func (p *CDPProxy) rewriteClientCommand(clientID string, cdpMsg *CDPMessage, message []byte) []byte {
+	if !cdpMsg.IsCommand() {
+		return message
+	}
+
+	targetID, _ := cdpMsg.Params["targetId"].(string)
+	awaitPromise, _ := cdpMsg.Params["awaitPromise"].(bool)
+	proxyID := p.commands.track(&pendingCommand{
+		clientID:     clientID,
+		originalID:   cdpMsg.ID,
+		method:       cdpMsg.Method,
+		sessionID:    cdpMsg.SessionID,
+		targetID:     targetID,
+		sentAt:       time.Now(),
+		awaitPromise: awaitPromise,
+	})
+
+	rewritten, err := setMessageField(message, "id", proxyID)
+	if err != nil {
+		p.commands.resolve(proxyID)
+		slog.Error("Error rewriting command id", logging.KeyClientID, clientID, logging.KeyMethod, cdpMsg.Method, logging.KeyCDPID, cdpMsg.ID, "error", err)
+		return message
+	}
+	return rewritten
+}
+
+// sendInternalCommand issues a command on behalf of the proxy itself. The
+// response is handed to onResponse instead of being delivered to a client. It
+// returns the proxy ID, under which a caller that stops waiting can resolve
+// the command.
+func (p *CDPProxy) sendInternalCommand(sessionID, method string, params map[string]interface{}, onResponse func(*CDPMessage)) (int, error) {
+	if onResponse == nil {
+		onResponse = func(*CDPMessage) {}
+	}
+
+	targetID, _ := params["targetId"].(string)
+	return p.sendTrackedCommand(&pendingCommand{
+		method:    method,
+		sessionID: sessionID,
+		targetID:  targetID,
+		sentAt:    time.Now(),
+		callback:  onResponse,
+	}, params)
+}
+
+func (p *CDPProxy) sendTrackedCommand(cmd *pendingCommand, params map[string]interface{}) (int, error) {
+	proxyID := p.commands.track(cmd)
+
+	data, err := buildCommand(proxyID, cmd.sessionID, cmd.method, params)
+	if err != nil {
+		p.commands.resolve(proxyID)
+		return 0, err
+	}
+
+	if !p.enqueueBrowserMessage(data) {
+		p.commands.resolve(proxyID)
+		return 0, errors.New("proxy is shutting down")
+	}
+	return proxyID, nil
+}
+
+// respond answers a client command on behalf of the browser. A nil error
+// produces an empty successful result.
+func (p *CDPProxy) respond(clientID string, cmd *CDPMessage, result interface{}, cdpErr *CDPError) {
+	response := map[string]interface{}{"id": cmd.ID}
+	if cdpErr != nil {
+		response["error"] = cdpErr
+	} else {
+		if result == nil {
+			result = struct{}{}
+		}
+		response["result"] = result
+	}
+	if cmd.SessionID != "" {
+		response["sessionId"] = cmd.SessionID
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		slog.Error("Error encoding response", logging.KeyClientID, clientID, logging.KeyCDPID, cmd.ID, "error", err)
+		return
+	}
+	p.deliverTo(clientID, cmd.SessionID, data, "")
+}
+
+// notifyClient sends a synthetic CDP event that did not come from the browser.
+func (p *CDPProxy) notifyClient(clientID, method string, params map[string]interface{}) {
+	data, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": params,
+	})
+	if err != nil {
+		slog.Error("Error encoding event", logging.KeyClientID, clientID, logging.KeyMethod, method, "error", err)
+		return
+	}
+	p.deliverTo(clientID, "", data, "")
+}
+
+func (p *CDPProxy) enqueueBrowserMessage(message []byte) bool {
+	select {
+	case p.browserMessages <- message:
+		return true
+	case <-p.shutdown:
+		return false
+	}
+}
+
+func buildCommand(id int, sessionID, method string, params map[string]interface{}) ([]byte, error) {
+	cmd := map[string]interface{}{
+		"id":     id,
+		"method": method,
+	}
+	if params != nil {
+		cmd["params"] = params
+	}
+	if sessionID != "" {
+		cmd["sessionId"] = sessionID
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s command: %w", method, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,142 @@
+package browser
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newRoutingTestProxy(clientIDs ...string) *CDPProxy {
+	proxy := &CDPProxy{
+		clients:         make(map[string]*Client),
+		eventDispatcher: &mockDispatcher{},
+		config:          DefaultConfig(),
+		browserMessages: make(chan []byte, 100),
+		shutdown:        make(chan struct{}),
+		connected:       true,
+	}
+
+	for _, id := range clientIDs {
+		proxy.clients[id] = &Client{
+			ID:        id,
+			Send:      make(chan []byte, 256),
+			Connected: true,
+		}
+	}
+	return proxy
+}
+
+func receiveMessage(t *testing.T, client *Client) *CDPMessage {
+	t.Helper()
+
+	select {
+	case raw := <-client.Send:
+		msg, err := ParseCDPMessage(raw)
+		if err != nil {
+			t.Fatalf("Client %s received invalid message %s: %v", client.ID, raw, err)
+		}
+		return msg
+	case <-time.After(100 * time.Millisecond):
+		t.Fatalf("Client %s did not receive a message", client.ID)
+		return nil
+	}
+}
+
+func expectNoMessage(t *testing.T, client *Client) {
+	t.Helper()
+
+	select {
+	case raw := <-client.Send:
+		t.Fatalf("Client %s received unexpected message %s", client.ID, raw)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCommandIDRemapping(t *testing.T) {
+	proxy := newRoutingTestProxy("a", "b")
+	command := []byte(`{"id":1,"method":"Runtime.evaluate","params":{"expression":"1+1"}}`)
+
+	upstreamIDs := map[string]int{}
+	for _, clientID := range []string{"a", "b"} {
+		cdpMsg, _ := ParseCDPMessage(command)
+		rewritten := proxy.rewriteClientCommand(clientID, cdpMsg, command)
+
+		upstream, err := ParseCDPMessage(rewritten)
+		if err != nil {
+			t.Fatalf("Rewritten command is not valid CDP: %v", err)
+		}
+		if upstream.Method != "Runtime.evaluate" || upstream.Params["expression"] != "1+1" {
+			t.Errorf("Rewriting changed the command payload: %s", rewritten)
+		}
+		upstreamIDs[clientID] = upstream.ID
+	}
+
+	if upstreamIDs["a"] == upstreamIDs["b"] {
+		t.Fatalf("Expected distinct upstream IDs, both clients got %d", upstreamIDs["a"])
+	}
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"value":"b"}}`, upstreamIDs["b"])))
+
+	response := receiveMessage(t, proxy.clients["b"])
+	if response.ID != 1 {
+		t.Errorf("Expected original id 1 to be restored, got %d", response.ID)
+	}
+
+	var result map[string]string
+	if err := json.Unmarshal(response.Result, &result); err != nil || result["value"] != "b" {
+		t.Errorf("Expected client b's result, got %s", response.Result)
+	}
+	expectNoMessage(t, proxy.clients["a"])
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"value":"a"}}`, upstreamIDs["a"])))
+	if response := receiveMessage(t, proxy.clients["a"]); response.ID != 1 {
+		t.Errorf("Expected original id 1 to be restored, got %d", response.ID)
+	}
+	expectNoMessage(t, proxy.clients["b"])
+}
+
+func TestCommandIDZero(t *testing.T) {
+	proxy := newRoutingTestProxy("a", "b")
+	command := []byte(`{"id":0,"method":"Target.getTargets"}`)
+
+	upstreamIDs := map[string]int{}
+	for _, clientID := range []string{"a", "b"} {
+		cdpMsg, _ := ParseCDPMessage(command)
+		if !cdpMsg.IsCommand() {
+			t.Fatalf("Expected a message with id 0 to be a command")
+		}
+		upstream, _ := ParseCDPMessage(proxy.rewriteClientCommand(clientID, cdpMsg, command))
+		if upstream.ID == 0 {
+			t.Fatalf("Expected client %s's command to get a proxy id", clientID)
+		}
+		upstreamIDs[clientID] = upstream.ID
+	}
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"targetInfos":[]}}`, upstreamIDs["b"])))
+
+	response := receiveMessage(t, proxy.clients["b"])
+	if !response.IsResponse() || response.ID != 0 {
+		t.Errorf("Expected client b's response with id 0, got %+v", response)
+	}
+	expectNoMessage(t, proxy.clients["a"])
+}
+
+func TestCommandTrackerDropClient(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	command := []byte(`{"id":7,"method":"Page.navigate","params":{"url":"about:blank"}}`)
+
+	cdpMsg, _ := ParseCDPMessage(command)
+	upstream, _ := ParseCDPMessage(proxy.rewriteClientCommand("a", cdpMsg, command))
+
+	if got := proxy.commands.countForClient("a"); got != 1 {
+		t.Fatalf("Expected 1 in-flight command, got %d", got)
+	}
+
+	if dropped := proxy.commands.dropClient("a"); dropped != 1 {
+		t.Errorf("Expected 1 dropped command, got %d", dropped)
+	}
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{}}`, upstream.ID)))
+	expectNoMessage(t, proxy.clients["a"])
+}
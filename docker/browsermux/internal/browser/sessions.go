@@ -0,0 +1,479 @@
+package browser
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/logging"
+)
+
+// pageBinding ties a client connected to /devtools/page/{targetId} to the
+// flattened session the proxy opened for that target on its behalf.
+type pageBinding struct {
+	targetID  string
+	sessionID string
+	held      [][]byte
+}
+
+// attachedSession is a session a client opened explicitly. targetID is empty
+// for sessions opened with Target.attachToBrowserTarget.
+type attachedSession struct {
+	sessionID string
+	clientID  string
+	targetID  string
+}
+
+// sessionTable tracks flattened CDP sessions and the clients they belong to.
+// Ownership is learned from attach responses and Target.attachedToTarget
+// events. Sessions re-opened after a reconnect keep the ID their client knows;
+// upstream and aliases translate between that ID and the browser's new one.
+type sessionTable struct {
+	mu       sync.Mutex
+	owners   map[string]string
+	targets  map[string]string
+	pages    map[string]*pageBinding
+	attached map[string]string
+	upstream map[string]string
+	aliases  map[string]string
+}
+
+// claim records the client as the owner of the session. targetID may be empty
+// when the target is not known.
+func (t *sessionTable) claim(sessionID, clientID, targetID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.owners == nil {
+		t.owners = make(map[string]string)
+	}
+	t.owners[sessionID] = clientID
+	t.setTarget(sessionID, targetID)
+}
+
+// setTarget remembers the target of a session. Callers must hold t.mu.
+func (t *sessionTable) setTarget(sessionID, targetID string) {
+	if targetID == "" {
+		return
+	}
+	if t.targets == nil {
+		t.targets = make(map[string]string)
+	}
+	t.targets[sessionID] = targetID
+}
+
+// recordAttach marks the session as explicitly attached to the target, so that
+// it is re-opened after a reconnect.
+func (t *sessionTable) recordAttach(sessionID, targetID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.attached == nil {
+		t.attached = make(map[string]string)
+	}
+	t.attached[sessionID] = targetID
+}
+
+func (t *sessionTable) bindPage(clientID, targetID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pages == nil {
+		t.pages = make(map[string]*pageBinding)
+	}
+	t.pages[clientID] = &pageBinding{targetID: targetID}
+}
+
+// routePageMessage reports the session a page client's message has to be sent
+// on. Messages sent before the session is attached are held and held is true.
+func (t *sessionTable) routePageMessage(clientID string, message []byte) (sessionID string, bound bool, held bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	binding, ok := t.pages[clientID]
+	if !ok {
+		return "", false, false
+	}
+
+	if binding.sessionID == "" {
+		binding.held = append(binding.held, message)
+		return "", true, true
+	}
+	return binding.sessionID, true, false
+}
+
+// attachPage records the session opened for a page client and returns the
+// messages it sent while the attach was in flight.
+func (t *sessionTable) attachPage(clientID, sessionID string) ([][]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	binding, ok := t.pages[clientID]
+	if !ok {
+		return nil, false
+	}
+
+	if t.owners == nil {
+		t.owners = make(map[string]string)
+	}
+	if t.attached == nil {
+		t.attached = make(map[string]string)
+	}
+
+	binding.sessionID = sessionID
+	t.owners[sessionID] = clientID
+	t.attached[sessionID] = binding.targetID
+	t.setTarget(sessionID, binding.targetID)
+
+	held := binding.held
+	binding.held = nil
+	return held, true
+}
+
+func (t *sessionTable) owner(sessionID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.owners[sessionID]
+}
+
+func (t *sessionTable) isPageClient(clientID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, ok := t.pages[clientID]
+	return ok
+}
+
+func (t *sessionTable) isPageSession(sessionID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	binding, ok := t.pages[t.owners[sessionID]]
+	return ok && sessionID != "" && binding.sessionID == sessionID
+}
+
+func (t *sessionTable) pageTarget(clientID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if binding, ok := t.pages[clientID]; ok {
+		return binding.targetID
+	}
+	return ""
+}
+
+func (t *sessionTable) pageSession(clientID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if binding, ok := t.pages[clientID]; ok {
+		return binding.sessionID
+	}
+	return ""
+}
+
+// removeSession forgets a session that no longer exists upstream and returns
+// the page client it belonged to, if any.
+func (t *sessionTable) removeSession(sessionID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.forget(sessionID)
+
+	clientID, ok := t.owners[sessionID]
+	if !ok {
+		return ""
+	}
+	delete(t.owners, sessionID)
+	delete(t.targets, sessionID)
+
+	if binding, isPage := t.pages[clientID]; isPage && binding.sessionID == sessionID {
+		delete(t.pages, clientID)
+		return clientID
+	}
+	return ""
+}
+
+// dropClient forgets everything the client owned and returns the sessions that
+// are still attached upstream.
+func (t *sessionTable) dropClient(clientID string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var sessions []string
+	for sessionID, owner := range t.owners {
+		if owner == clientID {
+			sessions = append(sessions, sessionID)
+			delete(t.owners, sessionID)
+			delete(t.attached, sessionID)
+			delete(t.targets, sessionID)
+		}
+	}
+	delete(t.pages, clientID)
+	return sessions
+}
+
+// ownedBy returns the sessions the client owns and the targets they are
+// attached to, sorted.
+func (t *sessionTable) ownedBy(clientID string) (sessionIDs, targetIDs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sessionIDs, targetIDs = []string{}, []string{}
+	seen := make(map[string]bool)
+	for sessionID, owner := range t.owners {
+		if owner != clientID {
+			continue
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+		if targetID := t.targets[sessionID]; targetID != "" && !seen[targetID] {
+			seen[targetID] = true
+			targetIDs = append(targetIDs, targetID)
+		}
+	}
+	if binding, ok := t.pages[clientID]; ok && !seen[binding.targetID] {
+		targetIDs = append(targetIDs, binding.targetID)
+	}
+
+	sort.Strings(sessionIDs)
+	sort.Strings(targetIDs)
+	return sessionIDs, targetIDs
+}
+
+// forget drops what is known about a session besides its owner. Callers must
+// hold t.mu.
+func (t *sessionTable) forget(sessionID string) {
+	delete(t.attached, sessionID)
+	if upstreamID, ok := t.upstream[sessionID]; ok {
+		delete(t.aliases, upstreamID)
+		delete(t.upstream, sessionID)
+	}
+}
+
+// restorable splits the owned sessions into those a client attached
+// explicitly, which can be re-opened, and those the browser auto-attached.
+func (t *sessionTable) restorable() (explicit, auto []attachedSession) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for sessionID, clientID := range t.owners {
+		session := attachedSession{sessionID: sessionID, clientID: clientID}
+		if targetID, ok := t.attached[sessionID]; ok {
+			session.targetID = targetID
+			explicit = append(explicit, session)
+		} else {
+			auto = append(auto, session)
+		}
+	}
+	return explicit, auto
+}
+
+// alias makes the client-facing sessionID refer to the session the browser
+// opened as upstreamID.
+func (t *sessionTable) alias(sessionID, upstreamID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.upstream == nil {
+		t.upstream = make(map[string]string)
+		t.aliases = make(map[string]string)
+	}
+	if previous, ok := t.upstream[sessionID]; ok {
+		delete(t.aliases, previous)
+	}
+
+	if sessionID == upstreamID {
+		delete(t.upstream, sessionID)
+		return
+	}
+	t.upstream[sessionID] = upstreamID
+	t.aliases[upstreamID] = sessionID
+}
+
+func (t *sessionTable) upstreamID(sessionID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if upstreamID, ok := t.upstream[sessionID]; ok {
+		return upstreamID
+	}
+	return sessionID
+}
+
+func (t *sessionTable) clientSessionID(upstreamID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if sessionID, ok := t.aliases[upstreamID]; ok {
+		return sessionID
+	}
+	return upstreamID
+}
+
+func (t *sessionTable) hasAliases() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.upstream) > 0
+}
+
+// attachPageClient opens a flattened session to the client's target so that
+// page-level connections only ever talk to their own page.
+func (p *CDPProxy) attachPageClient(clientID, targetID string) error {
+	params := map[string]interface{}{
+		"targetId": targetID,
+		"flatten":  true,
+	}
+
+	_, err := p.sendInternalCommand("", "Target.attachToTarget", params, func(resp *CDPMessage) {
+		if resp.Error != nil {
+			slog.Warn("Failed to attach client to target", logging.KeyClientID, clientID, logging.KeyTargetID, targetID, "error", resp.Error.Message)
+			p.closeClient(clientID, websocket.CloseInternalServerErr, "failed to attach to target: "+resp.Error.Message)
+			return
+		}
+
+		var result struct {
+			SessionID string `json:"sessionId"`
+		}
+		if err := json.Unmarshal(resp.Result, &result); err != nil || result.SessionID == "" {
+			slog.Error("Invalid attach response", logging.KeyClientID, clientID, logging.KeyTargetID, targetID, "result", string(resp.Result))
+			p.closeClient(clientID, websocket.CloseInternalServerErr, "failed to attach to target")
+			return
+		}
+
+		held, ok := p.sessions.attachPage(clientID, result.SessionID)
+		if !ok {
+			// The client went away while the attach was in flight.
+			p.detachSessions([]string{result.SessionID})
+			return
+		}
+
+		slog.Info("Client attached to target", logging.KeyClientID, clientID, logging.KeyTargetID, targetID, logging.KeySessionID, result.SessionID)
+
+		for _, message := range held {
+			if forwarded, ok := p.prepareClientMessage(clientID, message); ok {
+				p.enqueueBrowserMessage(forwarded)
+			}
+		}
+	})
+	return err
+}
+
+// claimAttachedSession assigns the session announced by Target.attachedToTarget
+// to a client: whoever is attaching to the target right now, else the owner of
+// the parent session, else whoever enabled auto-attach on the parent. It
+// reports true when the session belongs to an attach the proxy made itself.
+func (p *CDPProxy) claimAttachedSession(cdpMsg *CDPMessage) bool {
+	sessionID, _ := cdpMsg.Params["sessionId"].(string)
+	if sessionID == "" {
+		return false
+	}
+
+	var targetID string
+	if info, ok := cdpMsg.Params["targetInfo"].(map[string]interface{}); ok {
+		targetID, _ = info["targetId"].(string)
+	}
+
+	if cmd, ok := p.commands.findAttach(targetID); ok {
+		if cmd.callback != nil {
+			return true
+		}
+		p.sessions.claim(sessionID, cmd.clientID, targetID)
+		return false
+	}
+
+	ownerID := ""
+	if cdpMsg.SessionID != "" {
+		ownerID = p.sessions.owner(cdpMsg.SessionID)
+	}
+	if ownerID == "" {
+		ownerID = p.domains.firstHolder(domainKey{sessionID: cdpMsg.SessionID, domain: autoAttachDomain})
+	}
+
+	if ownerID != "" {
+		p.sessions.claim(sessionID, ownerID, targetID)
+	}
+	return false
+}
+
+func (p *CDPProxy) claimSessionFromResult(cmd *pendingCommand, result json.RawMessage) {
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(result, &attached); err == nil && attached.SessionID != "" {
+		p.sessions.claim(attached.SessionID, cmd.clientID, cmd.targetID)
+		p.sessions.recordAttach(attached.SessionID, cmd.targetID)
+	}
+}
+
+// eventOwner returns the client an event has to be delivered to exclusively, or
+// "" when it should go to every browser-level client. Attach and detach events
+// belong to the owner of the session they announce.
+func (p *CDPProxy) eventOwner(cdpMsg *CDPMessage) string {
+	switch cdpMsg.Method {
+	case "Target.attachedToTarget", "Target.detachedFromTarget":
+		if sessionID, _ := cdpMsg.Params["sessionId"].(string); sessionID != "" {
+			if ownerID := p.sessions.owner(sessionID); ownerID != "" {
+				return ownerID
+			}
+		}
+	}
+
+	if cdpMsg.SessionID != "" {
+		return p.sessions.owner(cdpMsg.SessionID)
+	}
+	return ""
+}
+
+func isAttachCommand(method string) bool {
+	return method == "Target.attachToTarget" || method == "Target.attachToBrowserTarget"
+}
+
+func (p *CDPProxy) detachSessions(sessionIDs []string) {
+	for _, sessionID := range sessionIDs {
+		params := map[string]interface{}{"sessionId": p.sessions.upstreamID(sessionID)}
+		if _, err := p.sendInternalCommand("", "Target.detachFromTarget", params, nil); err != nil {
+			slog.Warn("Failed to detach session", logging.KeySessionID, sessionID, "error", err)
+		}
+	}
+}
+
+// handleTargetDetached closes page-level clients whose target went away, the
+// same way the browser closes its own page endpoints.
+func (p *CDPProxy) handleTargetDetached(cdpMsg *CDPMessage) {
+	sessionID, _ := cdpMsg.Params["sessionId"].(string)
+	if sessionID == "" {
+		return
+	}
+
+	p.domains.dropSession(sessionID)
+	if clientID := p.sessions.removeSession(sessionID); clientID != "" {
+		p.closeClient(clientID, websocket.CloseNormalClosure, "target detached")
+	}
+}
+
+func (p *CDPProxy) closeClient(clientID string, code int, reason string) {
+	p.mu.RLock()
+	client, exists := p.clients[clientID]
+	p.mu.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	if err := client.closeConn(code, reason); err != nil {
+		slog.Debug("Error closing client", logging.KeyClientID, clientID, "error", err)
+	}
+}
+
+func stripSessionID(message []byte) []byte {
+	stripped, err := setMessageField(message, "sessionId", nil)
+	if err != nil {
+		return message
+	}
+	return stripped
+}
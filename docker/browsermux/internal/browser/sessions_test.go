@@ -0,0 +1,158 @@
+package browser
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func readBrowserMessage(t *testing.T, proxy *CDPProxy) *CDPMessage {
+	t.Helper()
+
+	select {
+	case raw := <-proxy.browserMessages:
+		msg, err := ParseCDPMessage(raw)
+		if err != nil {
+			t.Fatalf("Proxy wrote invalid message upstream %s: %v", raw, err)
+		}
+		return msg
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Nothing was written upstream")
+		return nil
+	}
+}
+
+func TestPageClientBinding(t *testing.T) {
+	proxy := newRoutingTestProxy("page", "browser")
+	proxy.sessions.bindPage("page", "TARGET-1")
+
+	if _, ok := proxy.prepareClientMessage("page", []byte(`{"id":1,"method":"Page.enable"}`)); ok {
+		t.Fatal("Expected message to be held until the page session is attached")
+	}
+
+	if err := proxy.attachPageClient("page", "TARGET-1"); err != nil {
+		t.Fatalf("attachPageClient() error = %v", err)
+	}
+
+	attach := readBrowserMessage(t, proxy)
+	if attach.Method != "Target.attachToTarget" || attach.Params["targetId"] != "TARGET-1" || attach.Params["flatten"] != true {
+		t.Fatalf("Unexpected attach command: %+v", attach)
+	}
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"sessionId":"S1"}}`, attach.ID)))
+
+	held := readBrowserMessage(t, proxy)
+	if held.Method != "Page.enable" || held.SessionID != "S1" {
+		t.Fatalf("Expected held command to be sent on session S1, got %+v", held)
+	}
+
+	t.Run("Responses are stripped of the page session", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{},"sessionId":"S1"}`, held.ID)))
+
+		response := receiveMessage(t, proxy.clients["page"])
+		if response.ID != 1 || response.SessionID != "" {
+			t.Errorf("Expected response id 1 without sessionId, got %+v", response)
+		}
+	})
+
+	t.Run("Page events only reach the page client", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Page.loadEventFired","params":{},"sessionId":"S1"}`))
+
+		event := receiveMessage(t, proxy.clients["page"])
+		if event.Method != "Page.loadEventFired" || event.SessionID != "" {
+			t.Errorf("Expected stripped page event, got %+v", event)
+		}
+		expectNoMessage(t, proxy.clients["browser"])
+	})
+
+	t.Run("Browser-level events skip page clients", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Target.targetCreated","params":{}}`))
+
+		receiveMessage(t, proxy.clients["browser"])
+		expectNoMessage(t, proxy.clients["page"])
+	})
+
+	t.Run("Later commands carry the session", func(t *testing.T) {
+		forwarded, ok := proxy.prepareClientMessage("page", []byte(`{"id":2,"method":"Runtime.evaluate","params":{"expression":"1"}}`))
+		if !ok {
+			t.Fatal("Expected command to be forwarded")
+		}
+
+		msg, _ := ParseCDPMessage(forwarded)
+		if msg.SessionID != "S1" {
+			t.Errorf("Expected sessionId S1 to be injected, got %q", msg.SessionID)
+		}
+	})
+
+	t.Run("Target detach unbinds the client", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Target.detachedFromTarget","params":{"sessionId":"S1","targetId":"TARGET-1"}}`))
+
+		if proxy.sessions.isPageClient("page") {
+			t.Error("Expected page binding to be removed after detach")
+		}
+	})
+}
+
+func TestSessionOwnership(t *testing.T) {
+	proxy := newRoutingTestProxy("a", "b")
+
+	forwarded, _ := proxy.prepareClientMessage("a", []byte(`{"id":1,"method":"Target.attachToTarget","params":{"targetId":"T1","flatten":true}}`))
+	attach, _ := ParseCDPMessage(forwarded)
+
+	proxy.HandleBrowserMessage([]byte(`{"method":"Target.attachedToTarget","params":{"sessionId":"SA","targetInfo":{"targetId":"T1","type":"page"},"waitingForDebugger":false}}`))
+	if event := receiveMessage(t, proxy.clients["a"]); event.Method != "Target.attachedToTarget" {
+		t.Fatalf("Expected attachedToTarget for the attaching client, got %+v", event)
+	}
+	expectNoMessage(t, proxy.clients["b"])
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"sessionId":"SA"}}`, attach.ID)))
+	receiveMessage(t, proxy.clients["a"])
+
+	t.Run("Session events reach only the owner", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Runtime.consoleAPICalled","params":{},"sessionId":"SA"}`))
+
+		if event := receiveMessage(t, proxy.clients["a"]); event.SessionID != "SA" {
+			t.Errorf("Expected sessionId to be kept for flattened sessions, got %+v", event)
+		}
+		expectNoMessage(t, proxy.clients["b"])
+	})
+
+	t.Run("Auto-attached sessions go to the auto-attach client", func(t *testing.T) {
+		proxy.prepareClientMessage("b", []byte(`{"id":1,"method":"Target.setAutoAttach","params":{"autoAttach":true,"waitForDebuggerOnStart":false,"flatten":true}}`))
+
+		proxy.HandleBrowserMessage([]byte(`{"method":"Target.attachedToTarget","params":{"sessionId":"SB","targetInfo":{"targetId":"T2","type":"page"},"waitingForDebugger":false}}`))
+		receiveMessage(t, proxy.clients["b"])
+		expectNoMessage(t, proxy.clients["a"])
+
+		proxy.HandleBrowserMessage([]byte(`{"method":"Network.requestWillBeSent","params":{},"sessionId":"SB"}`))
+		receiveMessage(t, proxy.clients["b"])
+		expectNoMessage(t, proxy.clients["a"])
+	})
+
+	t.Run("Children of an owned session follow their parent", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Target.attachedToTarget","params":{"sessionId":"SA2","targetInfo":{"targetId":"W1","type":"worker"},"waitingForDebugger":false},"sessionId":"SA"}`))
+		receiveMessage(t, proxy.clients["a"])
+		expectNoMessage(t, proxy.clients["b"])
+
+		if owner := proxy.sessions.owner("SA2"); owner != "a" {
+			t.Errorf("Expected worker session to belong to a, got %q", owner)
+		}
+	})
+
+	t.Run("Detach tears the session down", func(t *testing.T) {
+		proxy.HandleBrowserMessage([]byte(`{"method":"Target.detachedFromTarget","params":{"sessionId":"SA","targetId":"T1"}}`))
+		receiveMessage(t, proxy.clients["a"])
+		expectNoMessage(t, proxy.clients["b"])
+
+		if owner := proxy.sessions.owner("SA"); owner != "" {
+			t.Errorf("Expected session SA to be forgotten, still owned by %q", owner)
+		}
+	})
+
+	t.Run("Client removal releases its sessions", func(t *testing.T) {
+		sessions := proxy.sessions.dropClient("b")
+		if len(sessions) != 1 || sessions[0] != "SB" {
+			t.Errorf("Expected SB to be released, got %v", sessions)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package browser
+
+import (
+	"fmt"
+
+	"browsermux/internal/metrics"
+)
+
+// SlowConsumerPolicy decides what happens when a client does not read its
+// messages fast enough and its send queue fills up.
+type SlowConsumerPolicy string
+
+const (
+	// SlowConsumerDisconnect closes the client with CloseSlowConsumer as soon as
+	// its queue is full.
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+	// SlowConsumerDropEvents drops events once the queue is nearly full but
+	// keeps room for command responses, which are never dropped.
+	SlowConsumerDropEvents SlowConsumerPolicy = "drop_events"
+	// SlowConsumerSampleEvents behaves like SlowConsumerDropEvents and, once the
+	// queue is half full, only delivers every n-th high-volume event.
+	SlowConsumerSampleEvents SlowConsumerPolicy = "sample_events"
+)
+
+// CloseSlowConsumer is the WebSocket close code used for clients disconnected
+// because they could not keep up.
+const CloseSlowConsumer = 4008
+
+// DefaultSampledEventMethods are the high-volume events thinned out by
+// SlowConsumerSampleEvents.
+var DefaultSampledEventMethods = []string{
+	"Animation.*",
+	"Log.entryAdded",
+	"Network.dataReceived",
+	"Network.requestWillBeSentExtraInfo",
+	"Network.responseReceivedExtraInfo",
+	"Runtime.consoleAPICalled",
+}
+
+const defaultSampleRate = 10
+
+// ParseSlowConsumerPolicy validates a policy name. An empty name selects
+// SlowConsumerDropEvents.
+func ParseSlowConsumerPolicy(policy string) (SlowConsumerPolicy, error) {
+	switch SlowConsumerPolicy(policy) {
+	case "":
+		return SlowConsumerDropEvents, nil
+	case SlowConsumerDisconnect, SlowConsumerDropEvents, SlowConsumerSampleEvents:
+		return SlowConsumerPolicy(policy), nil
+	}
+	return "", fmt.Errorf("invalid slow consumer policy %q", policy)
+}
+
+// deliver queues a message for a client, applying the slow-consumer policy.
+// eventMethod is empty for responses and other messages that must not be
+// dropped. Callers must hold p.mu.
+func (p *CDPProxy) deliver(client *Client, message []byte, eventMethod string) {
+	if !client.Connected {
+		return
+	}
+
+	policy, _ := ParseSlowConsumerPolicy(string(p.config.SlowConsumerPolicy))
+	capacity := cap(client.Send)
+	depth := len(client.Send)
+
+	if eventMethod != "" && policy != SlowConsumerDisconnect {
+		if policy == SlowConsumerSampleEvents && depth >= capacity/2 && p.isSampledEvent(eventMethod) {
+			rate := p.config.SlowConsumerSampleRate
+			if rate <= 0 {
+				rate = defaultSampleRate
+			}
+			if client.stats.sampleCounter.Add(1)%uint64(rate) != 0 {
+				client.stats.sampled.Add(1)
+				metrics.RecordDrop(p.Name(), metrics.DropSampled)
+				return
+			}
+		}
+
+		// Keep a quarter of the queue free for responses.
+		if depth >= capacity-capacity/4 {
+			client.stats.dropped.Add(1)
+			metrics.RecordDrop(p.Name(), metrics.DropClientQueueFull)
+			return
+		}
+	}
+
+	select {
+	case client.Send <- message:
+	default:
+		if eventMethod != "" && policy != SlowConsumerDisconnect {
+			client.stats.dropped.Add(1)
+			metrics.RecordDrop(p.Name(), metrics.DropClientQueueFull)
+			return
+		}
+		p.evictSlowConsumer(client)
+	}
+}
+
+func (p *CDPProxy) isSampledEvent(method string) bool {
+	methods := p.config.SampledEventMethods
+	if methods == nil {
+		methods = DefaultSampledEventMethods
+	}
+	return matchesMethodList(methods, method)
+}
+
+// evictSlowConsumer closes a client whose queue overflowed. The read loop then
+// removes it, so this is safe to call while holding p.mu.
+func (p *CDPProxy) evictSlowConsumer(client *Client) {
+	client.stats.dropped.Add(1)
+	metrics.RecordDrop(p.Name(), metrics.DropSlowConsumer)
+	if !client.stats.evicted.CompareAndSwap(false, true) {
+		return
+	}
+
+	client.logger().Warn("Client message buffer full, disconnecting slow consumer")
+	go func() {
+		if err := client.closeConn(CloseSlowConsumer, "slow consumer"); err != nil {
+			client.logger().Debug("Error closing slow consumer", "error", err)
+		}
+	}()
+}
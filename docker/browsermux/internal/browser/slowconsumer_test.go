@@ -0,0 +1,81 @@
+package browser
+
+import "testing"
+
+func fillQueue(client *Client, n int) {
+	for i := 0; i < n; i++ {
+		client.Send <- []byte(`{"method":"Page.frameNavigated","params":{}}`)
+	}
+}
+
+func TestSlowConsumerDropEvents(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	client := &Client{ID: "slow", Send: make(chan []byte, 8), Connected: true}
+	proxy.clients["slow"] = client
+
+	fillQueue(client, 6)
+
+	proxy.mu.RLock()
+	proxy.deliver(client, []byte(`{"method":"Network.dataReceived","params":{}}`), "Network.dataReceived")
+	proxy.deliver(client, []byte(`{"id":1,"result":{}}`), "")
+	proxy.mu.RUnlock()
+
+	if got := len(client.Send); got != 7 {
+		t.Errorf("Expected the response to be queued and the event dropped, queue depth %d", got)
+	}
+
+	dto := client.ToModel()
+	if dto.DroppedMessages != 1 || dto.QueueDepth != 7 || dto.QueueCapacity != 8 {
+		t.Errorf("Unexpected client stats: %+v", dto)
+	}
+}
+
+func TestSlowConsumerSampleEvents(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	proxy.config.SlowConsumerPolicy = SlowConsumerSampleEvents
+	proxy.config.SlowConsumerSampleRate = 2
+
+	client := &Client{ID: "slow", Send: make(chan []byte, 16), Connected: true}
+	proxy.clients["slow"] = client
+	fillQueue(client, 8)
+
+	proxy.mu.RLock()
+	for i := 0; i < 4; i++ {
+		proxy.deliver(client, []byte(`{"method":"Network.dataReceived","params":{}}`), "Network.dataReceived")
+	}
+	proxy.deliver(client, []byte(`{"method":"Page.loadEventFired","params":{}}`), "Page.loadEventFired")
+	proxy.mu.RUnlock()
+
+	if got := client.stats.sampled.Load(); got != 2 {
+		t.Errorf("Expected 2 sampled-out events, got %d", got)
+	}
+	if got := len(client.Send); got != 11 {
+		t.Errorf("Expected 2 sampled events and the page event to be queued, queue depth %d", got)
+	}
+}
+
+func TestSlowConsumerDisconnect(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	proxy.config.SlowConsumerPolicy = SlowConsumerDisconnect
+
+	client := &Client{ID: "slow", Send: make(chan []byte, 2), Connected: true}
+	proxy.clients["slow"] = client
+	fillQueue(client, 2)
+
+	proxy.mu.RLock()
+	proxy.deliver(client, []byte(`{"method":"Page.loadEventFired","params":{}}`), "Page.loadEventFired")
+	proxy.mu.RUnlock()
+
+	if !client.stats.evicted.Load() {
+		t.Error("Expected the slow consumer to be evicted")
+	}
+}
+
+func TestParseSlowConsumerPolicy(t *testing.T) {
+	if policy, err := ParseSlowConsumerPolicy(""); err != nil || policy != SlowConsumerDropEvents {
+		t.Errorf("Expected drop_events default, got %q, %v", policy, err)
+	}
+	if _, err := ParseSlowConsumerPolicy("bogus"); err == nil {
+		t.Error("Expected error for unknown policy")
+	}
+}
@@ -0,0 +1,92 @@
+package browser
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"browsermux/internal/logging"
+)
+
+const defaultCommandTimeout = 30 * time.Second
+
+// DefaultCommandTimeouts are the per-method overrides used when the config does
+// not set any. Keys are exact method names or patterns like "Page.*"; a zero
+// duration never times out. Runtime.awaitPromise waits on the page, as
+// automation libraries do for their waitFor helpers.
+var DefaultCommandTimeouts = map[string]time.Duration{
+	"Page.printToPDF":      120 * time.Second,
+	"Runtime.awaitPromise": 0,
+}
+
+// commandTimeout returns how long the browser may take to answer the method.
+// Exact overrides win over patterns, the longest pattern wins over shorter
+// ones.
+func (p *CDPProxy) commandTimeout(method string) time.Duration {
+	if p.config.CommandTimeout <= 0 {
+		return 0
+	}
+
+	overrides := p.config.CommandTimeouts
+	if overrides == nil {
+		overrides = DefaultCommandTimeouts
+	}
+
+	if timeout, ok := overrides[method]; ok {
+		return timeout
+	}
+
+	timeout, matched := p.config.CommandTimeout, ""
+	for pattern, patternTimeout := range overrides {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(method, prefix) && len(pattern) > len(matched) {
+			timeout, matched = patternTimeout, pattern
+		}
+	}
+	return timeout
+}
+
+// pendingTimeout is the timeout of an in-flight command. Commands sent with
+// awaitPromise, like Runtime.evaluate or Runtime.callFunctionOn, wait on the
+// page and never time out.
+func (p *CDPProxy) pendingTimeout(cmd *pendingCommand) time.Duration {
+	if cmd.awaitPromise {
+		return 0
+	}
+	return p.commandTimeout(cmd.method)
+}
+
+// expireCommands answers commands the browser left unanswered for too long.
+// Their responses are discarded if they turn up later.
+func (p *CDPProxy) expireCommands() {
+	if p.config.CommandTimeout <= 0 {
+		return
+	}
+
+	for proxyID, cmd := range p.commands.expire(time.Now(), p.pendingTimeout) {
+		timeout := p.pendingTimeout(cmd)
+		slog.Warn("Command timed out", logging.KeyClientID, cmd.clientID, logging.KeyMethod, cmd.method, logging.KeyCDPID, cmd.originalID, logging.KeySessionID, cmd.sessionID, "timeout", timeout)
+
+		p.failCommand(proxyID, cmd, fmt.Sprintf("'%s' timed out after %s", cmd.method, timeout))
+
+		sourceType := "client"
+		if cmd.callback != nil {
+			sourceType = "proxy"
+		}
+
+		p.eventDispatcher.Dispatch(Event{
+			Type:       EventCDPTimeout,
+			Method:     cmd.method,
+			SourceID:   cmd.clientID,
+			SourceType: sourceType,
+			Timestamp:  time.Now(),
+			Params: map[string]interface{}{
+				"client_id":  cmd.clientID,
+				"id":         cmd.originalID,
+				"session_id": cmd.sessionID,
+				"timeout_ms": timeout.Milliseconds(),
+			},
+		})
+	}
+}
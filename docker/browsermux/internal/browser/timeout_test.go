@@ -0,0 +1,99 @@
+package browser
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCommandTimeoutTable(t *testing.T) {
+	proxy := newRoutingTestProxy()
+	proxy.config.CommandTimeout = 10 * time.Second
+	proxy.config.CommandTimeouts = map[string]time.Duration{
+		"Page.printToPDF":      2 * time.Minute,
+		"Page.*":               time.Minute,
+		"Runtime.awaitPromise": 0,
+	}
+
+	tests := []struct {
+		method string
+		want   time.Duration
+	}{
+		{"Page.printToPDF", 2 * time.Minute},
+		{"Page.navigate", time.Minute},
+		{"Runtime.awaitPromise", 0},
+		{"Runtime.evaluate", 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := proxy.commandTimeout(tt.method); got != tt.want {
+			t.Errorf("commandTimeout(%s) = %s, want %s", tt.method, got, tt.want)
+		}
+	}
+
+	proxy.config.CommandTimeouts = nil
+	if got := proxy.commandTimeout("Page.printToPDF"); got != DefaultCommandTimeouts["Page.printToPDF"] {
+		t.Errorf("Expected default override for Page.printToPDF, got %s", got)
+	}
+
+	proxy.config.CommandTimeout = 0
+	if got := proxy.commandTimeout("Page.printToPDF"); got != 0 {
+		t.Errorf("Expected timeouts to be disabled, got %s", got)
+	}
+}
+
+func TestCommandTimeoutExpiry(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	proxy.config.CommandTimeout = time.Second
+	client := proxy.clients["a"]
+
+	forwarded, _ := proxy.prepareClientMessage("a", []byte(`{"id":9,"method":"Runtime.evaluate","params":{"expression":"while(true){}"}}`))
+	proxyID := commandID(forwarded)
+
+	proxy.commands.markWritten(proxyID, time.Now())
+	proxy.expireCommands()
+	expectNoMessage(t, client)
+
+	proxy.commands.markWritten(proxyID, time.Now().Add(-2*time.Second))
+	proxy.expireCommands()
+
+	resp := receiveMessage(t, client)
+	if resp.ID != 9 || resp.Error == nil || resp.Error.Code != cdpServerError {
+		t.Fatalf("Expected timeout error for id 9, got %+v", resp)
+	}
+	if !hasEvent(proxy, EventCDPTimeout) {
+		t.Error("Expected cdp.timeout event to be dispatched")
+	}
+
+	proxy.HandleBrowserMessage([]byte(fmt.Sprintf(`{"id":%d,"result":{"result":{"type":"undefined"}}}`, proxyID)))
+	expectNoMessage(t, client)
+}
+
+func TestCommandTimeoutAwaitPromise(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	proxy.config.CommandTimeout = time.Second
+	client := proxy.clients["a"]
+
+	if got := proxy.commandTimeout("Runtime.awaitPromise"); got != 0 {
+		t.Errorf("Expected Runtime.awaitPromise to never time out by default, got %s", got)
+	}
+
+	var proxyIDs []int
+	for _, message := range []string{
+		`{"id":1,"method":"Runtime.evaluate","params":{"expression":"new Promise(() => {})","awaitPromise":true}}`,
+		`{"id":2,"method":"Runtime.callFunctionOn","params":{"functionDeclaration":"() => new Promise(() => {})","awaitPromise":true}}`,
+		`{"id":3,"method":"Runtime.awaitPromise","params":{"promiseObjectId":"1"}}`,
+	} {
+		forwarded, _ := proxy.prepareClientMessage("a", []byte(message))
+		proxyID := commandID(forwarded)
+		proxy.commands.markWritten(proxyID, time.Now().Add(-time.Hour))
+		proxyIDs = append(proxyIDs, proxyID)
+	}
+
+	proxy.expireCommands()
+	expectNoMessage(t, client)
+	for _, proxyID := range proxyIDs {
+		if !proxy.commands.isPending(proxyID) {
+			t.Errorf("Expected promise-awaiting command %d to stay pending", proxyID)
+		}
+	}
+}
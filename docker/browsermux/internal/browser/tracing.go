@@ -0,0 +1,135 @@
+package browser
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("browsermux/internal/browser")
+
+// commandSpans holds the spans of a client's commands until their responses
+// have been written to the client, keyed by the client's own command ID.
+type commandSpans struct {
+	mu    sync.Mutex
+	spans map[int]trace.Span
+}
+
+func (s *commandSpans) start(id int, span trace.Span) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spans == nil {
+		s.spans = make(map[int]trace.Span)
+	}
+	if previous, ok := s.spans[id]; ok {
+		previous.SetStatus(codes.Error, "command id reused before response")
+		previous.End()
+	}
+	s.spans[id] = span
+}
+
+func (s *commandSpans) finish(id int) (trace.Span, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span, ok := s.spans[id]
+	if ok {
+		delete(s.spans, id)
+	}
+	return span, ok
+}
+
+func (s *commandSpans) empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.spans) == 0
+}
+
+// endAll ends the spans of commands that will never be answered.
+func (s *commandSpans) endAll(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, span := range s.spans {
+		span.SetStatus(codes.Error, reason)
+		span.End()
+		delete(s.spans, id)
+	}
+}
+
+// traceContextFrom extracts the W3C trace context the client connected with,
+// so that its command spans join the caller's trace.
+func traceContextFrom(metadata map[string]interface{}) context.Context {
+	carrier := propagation.MapCarrier{}
+	for _, key := range []string{"traceparent", "tracestate", "baggage"} {
+		if value, ok := metadata[key].(string); ok && value != "" {
+			carrier[key] = value
+		}
+	}
+	return otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+}
+
+// startCommandSpan opens the span covering a client command until its response
+// is written back to the client.
+func (p *CDPProxy) startCommandSpan(client *Client, cdpMsg *CDPMessage) {
+	parent := client.traceCtx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	sessionID := cdpMsg.SessionID
+	if sessionID == "" {
+		sessionID = p.sessions.pageSession(client.ID)
+	}
+	targetID, _ := cdpMsg.Params["targetId"].(string)
+	if targetID == "" {
+		targetID = p.sessions.pageTarget(client.ID)
+	}
+
+	_, span := tracer.Start(parent, cdpMsg.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("cdp.method", cdpMsg.Method),
+			attribute.Int("cdp.id", cdpMsg.ID),
+			attribute.String("cdp.session_id", sessionID),
+			attribute.String("cdp.target_id", targetID),
+			attribute.String("browsermux.client_id", client.ID),
+			attribute.String("browsermux.client_role", string(p.clientRole(client.ID))),
+		),
+	)
+	if !span.IsRecording() {
+		return
+	}
+	client.spans.start(cdpMsg.ID, span)
+}
+
+// endCommandSpan ends the span of the command a response written to the client
+// answers.
+func (c *Client) endCommandSpan(message []byte) {
+	if c.spans.empty() {
+		return
+	}
+
+	cdpMsg, err := ParseCDPMessage(message)
+	if err != nil || !cdpMsg.IsResponse() {
+		return
+	}
+
+	span, ok := c.spans.finish(cdpMsg.ID)
+	if !ok {
+		return
+	}
+
+	if cdpMsg.Error != nil {
+		span.SetAttributes(attribute.Int("cdp.error_code", cdpMsg.Error.Code))
+		span.SetStatus(codes.Error, cdpMsg.Error.Message)
+	}
+	span.End()
+}
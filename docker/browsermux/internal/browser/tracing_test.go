@@ -0,0 +1,88 @@
+package browser
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCommandSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	proxy := newRoutingTestProxy("a")
+	client := proxy.clients["a"]
+	client.traceCtx = traceContextFrom(map[string]interface{}{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	})
+
+	cmd, _ := ParseCDPMessage([]byte(`{"id":5,"method":"Target.attachToTarget","params":{"targetId":"T1","flatten":true}}`))
+	proxy.startCommandSpan(client, cmd)
+
+	client.endCommandSpan([]byte(`{"method":"Target.targetCreated","params":{}}`))
+	if len(exporter.GetSpans()) != 0 {
+		t.Fatal("Expected events not to end command spans")
+	}
+
+	client.endCommandSpan([]byte(`{"id":5,"error":{"code":-32602,"message":"No target with given id found"}}`))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name != "Target.attachToTarget" {
+		t.Errorf("Expected span named after the method, got %s", span.Name)
+	}
+	if span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Expected span to join the client's trace, got %s", span.SpanContext.TraceID())
+	}
+	if span.Status.Code != codes.Error {
+		t.Errorf("Expected error status, got %v", span.Status)
+	}
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["cdp.target_id"].AsString() != "T1" || attrs["browsermux.client_id"].AsString() != "a" {
+		t.Errorf("Unexpected span attributes %v", span.Attributes)
+	}
+	if attrs["cdp.error_code"].AsInt64() != -32602 {
+		t.Errorf("Expected cdp.error_code attribute, got %v", attrs["cdp.error_code"])
+	}
+
+	proxy.startCommandSpan(client, cmd)
+	client.spans.endAll("client disconnected")
+	if len(exporter.GetSpans()) != 2 {
+		t.Error("Expected pending spans to end when the client goes away")
+	}
+
+	// Lock handoffs change the role while the client's read goroutine starts
+	// spans.
+	demoted := make(chan struct{})
+	go func() {
+		defer close(demoted)
+		proxy.mu.Lock()
+		client.Role = ClientRoleObserver
+		proxy.mu.Unlock()
+	}()
+	proxy.startCommandSpan(client, cmd)
+	<-demoted
+	proxy.startCommandSpan(client, cmd)
+	client.spans.endAll("client disconnected")
+
+	spans = exporter.GetSpans()
+	for _, kv := range spans[len(spans)-1].Attributes {
+		if kv.Key == "browsermux.client_role" && kv.Value.AsString() != string(ClientRoleObserver) {
+			t.Errorf("Expected the observer role, got %s", kv.Value.AsString())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package browser
 
 import (
+	"context"
 	"encoding/json"
 	"reflect"
 	"strings"
@@ -11,11 +12,34 @@ import (
 )
 
 type CDPMessage struct {
-	ID     int                    `json:"id,omitempty"`
-	Method string                 `json:"method,omitempty"`
-	Params map[string]interface{} `json:"params,omitempty"`
-	Result json.RawMessage        `json:"result,omitempty"`
-	Error  *CDPError              `json:"error,omitempty"`
+	ID        int                    `json:"id,omitempty"`
+	Method    string                 `json:"method,omitempty"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	Result    json.RawMessage        `json:"result,omitempty"`
+	Error     *CDPError              `json:"error,omitempty"`
+	SessionID string                 `json:"sessionId,omitempty"`
+
+	// hasID records whether a parsed message carried an id, since 0 is a
+	// valid command id.
+	hasID bool
+}
+
+// UnmarshalJSON records whether the message has an id besides decoding it.
+func (m *CDPMessage) UnmarshalJSON(data []byte) error {
+	type message CDPMessage
+	aux := struct {
+		ID *int `json:"id"`
+		*message
+	}{message: (*message)(m)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	m.ID, m.hasID = 0, aux.ID != nil
+	if aux.ID != nil {
+		m.ID = *aux.ID
+	}
+	return nil
 }
 
 type CDPError struct {
@@ -23,16 +47,20 @@ type CDPError struct {
 	Message string `json:"message"`
 }
 
+func (m *CDPMessage) hasCommandID() bool {
+	return m.hasID || m.ID != 0
+}
+
 func (m *CDPMessage) IsCommand() bool {
-	return m.ID != 0 && m.Method != ""
+	return m.hasCommandID() && m.Method != ""
 }
 
 func (m *CDPMessage) IsEvent() bool {
-	return m.ID == 0 && m.Method != ""
+	return !m.hasCommandID() && m.Method != ""
 }
 
 func (m *CDPMessage) IsResponse() bool {
-	return m.ID != 0 && m.Method == ""
+	return m.hasCommandID() && m.Method == ""
 }
 
 func ParseCDPMessage(data []byte) (*CDPMessage, error) {
@@ -81,35 +109,79 @@ type EventType string
 const (
 	EventCDPCommand EventType = "cdp.command"
 	EventCDPEvent   EventType = "cdp.event"
+	EventCDPTimeout EventType = "cdp.timeout"
 
 	EventClientConnected    EventType = "client.connected"
 	EventClientDisconnected EventType = "client.disconnected"
+	// EventClientEvicted records an administrative disconnect and who asked
+	// for it.
+	EventClientEvicted EventType = "client.evicted"
+
+	EventSessionLockTransferred EventType = "session.lock_transferred"
+	EventSessionLockRevoked     EventType = "session.lock_revoked"
+
+	EventBrowserDisconnected EventType = "browser.disconnected"
+	EventBrowserReconnected  EventType = "browser.reconnected"
+	// EventBrowserStateChanged reports a move between the connection states
+	// connecting, connected, backing_off, failed and stalled.
+	EventBrowserStateChanged EventType = "browser.state_changed"
+	// EventBrowserStalled reports a browser that stopped answering; the
+	// connection is dropped and reconnected.
+	EventBrowserStalled EventType = "browser.stalled"
+	// EventBrowserStateRestored lists the client state re-established after a
+	// reconnect and what could not be restored.
+	EventBrowserStateRestored EventType = "browser.state_restored"
 )
 
+// MatchesEventType reports whether eventType matches pattern, which is either
+// an exact type or a prefix ending in "*" such as "client.*".
+func MatchesEventType(pattern string, eventType EventType) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(string(eventType), prefix)
+	}
+	return pattern == string(eventType)
+}
+
+// MatchesMethod reports whether a CDP method matches pattern, which is either
+// an exact method or a prefix ending in "*" such as "Page.*".
+func MatchesMethod(pattern, method string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(method, prefix)
+	}
+	return pattern == method
+}
+
 type Event struct {
 	Type       EventType              `json:"type"`
 	Method     string                 `json:"method,omitempty"`
 	Params     map[string]interface{} `json:"params,omitempty"`
 	SourceType string                 `json:"source_type,omitempty"`
 	SourceID   string                 `json:"source_id,omitempty"`
-	Timestamp  time.Time              `json:"timestamp"`
+	// Browser names the upstream browser of a proxy created with a Name.
+	Browser   string    `json:"browser,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type EventHandler func(Event)
 
 type EventDispatcher interface {
 	Register(eventType EventType, handler EventHandler)
+	// RegisterSync registers a handler that runs on the dispatching goroutine
+	// and so sees events in dispatch order. It must not block.
+	RegisterSync(eventType EventType, handler EventHandler)
 	Dispatch(event Event)
 }
 
 type simpleEventDispatcher struct {
-	handlers map[EventType][]EventHandler
-	mu       sync.RWMutex
+	handlers     map[EventType][]EventHandler
+	syncHandlers map[EventType][]EventHandler
+	mu           sync.RWMutex
 }
 
 func NewEventDispatcher() EventDispatcher {
 	return &simpleEventDispatcher{
-		handlers: make(map[EventType][]EventHandler),
+		handlers:     make(map[EventType][]EventHandler),
+		syncHandlers: make(map[EventType][]EventHandler),
 	}
 }
 
@@ -120,10 +192,24 @@ func (d *simpleEventDispatcher) Register(eventType EventType, handler EventHandl
 	d.handlers[eventType] = append(d.handlers[eventType], handler)
 }
 
+func (d *simpleEventDispatcher) RegisterSync(eventType EventType, handler EventHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.syncHandlers[eventType] = append(d.syncHandlers[eventType], handler)
+}
+
 func (d *simpleEventDispatcher) Dispatch(event Event) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
+	for _, handler := range d.syncHandlers[event.Type] {
+		handler(event)
+	}
+	for _, handler := range d.syncHandlers["*"] {
+		handler(event)
+	}
+
 	if handlers, ok := d.handlers[event.Type]; ok {
 		for _, handler := range handlers {
 			go handler(event)
@@ -146,6 +232,11 @@ type Client struct {
 	Metadata   map[string]interface{}
 	CreatedAt  time.Time
 	Connected  bool
+	Role       ClientRole
+
+	stats    clientStats
+	traceCtx context.Context
+	spans    commandSpans
 }
 
 type ClientDTO struct {
@@ -155,6 +246,30 @@ type ClientDTO struct {
 	Connected bool                   `json:"connected"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
 	CreatedAt time.Time              `json:"created_at"`
+	Role      ClientRole             `json:"role"`
+
+	QueueDepth      int    `json:"queue_depth"`
+	QueueCapacity   int    `json:"queue_capacity"`
+	DroppedMessages uint64 `json:"dropped_messages"`
+	SampledEvents   uint64 `json:"sampled_events"`
+	ProtocolTrace   bool   `json:"protocol_trace"`
+
+	// Received and sent are from the proxy's side: received messages came from
+	// the client, sent messages were written to it.
+	MessagesReceived uint64     `json:"messages_received"`
+	MessagesSent     uint64     `json:"messages_sent"`
+	BytesReceived    uint64     `json:"bytes_received"`
+	BytesSent        uint64     `json:"bytes_sent"`
+	InFlightCommands int        `json:"inflight_commands"`
+	LastActivity     *time.Time `json:"last_activity,omitempty"`
+	LastMethod       string     `json:"last_method,omitempty"`
+	SessionIDs       []string   `json:"session_ids"`
+	TargetIDs        []string   `json:"target_ids"`
+}
+
+// MessageRecorder receives the raw messages relayed to and from clients.
+type MessageRecorder interface {
+	RecordMessage(direction, clientID string, message []byte)
 }
 
 type ClientManager interface {
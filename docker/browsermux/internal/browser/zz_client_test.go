@@ -1,6 +1,9 @@
 package browser
 
 import (
+	"bytes"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -17,6 +20,9 @@ type mockDispatcher struct {
 func (m *mockDispatcher) Register(eventType EventType, handler EventHandler) {
 }
 
+func (m *mockDispatcher) RegisterSync(eventType EventType, handler EventHandler) {
+}
+
 func (m *mockDispatcher) Dispatch(event Event) {
 	m.events = append(m.events, event)
 }
@@ -329,3 +335,200 @@ func TestProcessMessage(t *testing.T) {
 		}
 	})
 }
+
+func TestClientProtocolTrace(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer slog.SetDefault(previous)
+
+	proxy := newRoutingTestProxy("a")
+	client := proxy.clients["a"]
+	message := []byte(`{"id":1,"method":"Page.navigate","params":{"url":"https://example.com"}}`)
+
+	client.traceMessage("client_to_browser", message)
+	if strings.Contains(buf.String(), "Page.navigate") {
+		t.Fatalf("Expected no trace output before tracing is enabled, got %s", buf.String())
+	}
+
+	if err := proxy.SetClientTrace("a", true); err != nil {
+		t.Fatalf("Failed to enable trace: %v", err)
+	}
+	if !client.ToModel().ProtocolTrace {
+		t.Error("Expected client model to report protocol trace")
+	}
+
+	client.traceMessage("client_to_browser", message)
+	if !strings.Contains(buf.String(), "client_id=a") || !strings.Contains(buf.String(), "https://example.com") {
+		t.Errorf("Expected full message for client a in trace output, got %s", buf.String())
+	}
+
+	if err := proxy.SetClientTrace("a", false); err != nil {
+		t.Fatalf("Failed to disable trace: %v", err)
+	}
+	buf.Reset()
+	client.traceMessage("client_to_browser", message)
+	if strings.Contains(buf.String(), "Page.navigate") {
+		t.Errorf("Expected no trace output after tracing is disabled, got %s", buf.String())
+	}
+
+	if err := proxy.SetClientTrace("missing", true); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+}
+
+func TestGetClient(t *testing.T) {
+	proxy := newRoutingTestProxy("a", "b")
+	proxy.sessions.claim("S2", "a", "T2")
+	proxy.sessions.claim("S1", "a", "T1")
+	proxy.sessions.claim("S3", "a", "")
+	proxy.sessions.claim("S4", "b", "T4")
+
+	if _, ok := proxy.prepareClientMessage("a", []byte(`{"id":1,"method":"Runtime.evaluate","params":{"expression":"1"}}`)); !ok {
+		t.Fatal("Expected command to be forwarded")
+	}
+
+	stats := &proxy.clients["a"].stats
+	stats.recordReceived(40, "Runtime.evaluate")
+	stats.recordReceived(10, "")
+	stats.recordSent(25)
+
+	model, err := proxy.GetClient("a")
+	if err != nil {
+		t.Fatalf("GetClient failed: %v", err)
+	}
+
+	if model.MessagesReceived != 2 || model.BytesReceived != 50 || model.MessagesSent != 1 || model.BytesSent != 25 {
+		t.Errorf("Unexpected message counters %+v", model)
+	}
+	if model.LastMethod != "Runtime.evaluate" || model.LastActivity == nil {
+		t.Errorf("Expected last method and activity, got %q, %v", model.LastMethod, model.LastActivity)
+	}
+	if model.InFlightCommands != 1 {
+		t.Errorf("Expected 1 in-flight command, got %d", model.InFlightCommands)
+	}
+	if strings.Join(model.SessionIDs, ",") != "S1,S2,S3" || strings.Join(model.TargetIDs, ",") != "T1,T2" {
+		t.Errorf("Unexpected sessions %v and targets %v", model.SessionIDs, model.TargetIDs)
+	}
+
+	proxy.sessions.removeSession("S1")
+	if model, _ := proxy.GetClient("a"); strings.Join(model.TargetIDs, ",") != "T2" {
+		t.Errorf("Expected detached target to be dropped, got %v", model.TargetIDs)
+	}
+
+	if _, err := proxy.GetClient("missing"); !errors.Is(err, ErrClientNotFound) {
+		t.Errorf("Expected ErrClientNotFound, got %v", err)
+	}
+}
+
+// serveClient runs the read and write loops for a client connected through
+// dialTestClient and returns a channel closed once the client is removed.
+func serveClient(t *testing.T, proxy *CDPProxy, id string) (*websocket.Conn, <-chan struct{}) {
+	t.Helper()
+
+	conn, peer := dialTestClient(t)
+	client := proxy.clients[id]
+	client.Conn = conn
+
+	done := make(chan struct{})
+	go func() {
+		proxy.handleClientMessages(client)
+		close(done)
+	}()
+	go proxy.sendMessagesToClient(client)
+	return peer, done
+}
+
+func disconnectEvent(t *testing.T, proxy *CDPProxy, done <-chan struct{}) Event {
+	t.Helper()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the client to be removed")
+	}
+
+	for _, event := range proxy.eventDispatcher.(*mockDispatcher).events {
+		if event.Type == EventClientDisconnected {
+			return event
+		}
+	}
+	t.Fatal("Expected a client.disconnected event")
+	return Event{}
+}
+
+func TestClientMissingPongsIsRemoved(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	proxy.config.ClientPongWait = 50 * time.Millisecond
+	proxy.lockHolderID = "a"
+
+	// The peer never reads, so it never answers pings.
+	_, done := serveClient(t, proxy, "a")
+
+	event := disconnectEvent(t, proxy, done)
+	if event.Params["reason"] != "pong timeout" || event.Params["code"] != websocket.CloseAbnormalClosure {
+		t.Errorf("Expected a pong timeout, got %v", event.Params)
+	}
+	if proxy.GetLock().Locked {
+		t.Error("Expected the dead client to release the session lock")
+	}
+}
+
+func TestClientAnsweringPingsStaysConnected(t *testing.T) {
+	proxy := newRoutingTestProxy("a")
+	proxy.config.ClientPongWait = 100 * time.Millisecond
+	// Leave the pong plenty of time, so that a busy machine does not fail the
+	// test.
+	proxy.config.ClientPingInterval = 20 * time.Millisecond
+
+	peer, done := serveClient(t, proxy, "a")
+	go func() {
+		// Reading answers pings.
+		for {
+			if _, _, err := peer.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(400 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Expected a client answering pings to stay connected")
+	default:
+	}
+
+	peer.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(4000, "bye"), time.Now().Add(time.Second))
+
+	event := disconnectEvent(t, proxy, done)
+	if event.Params["reason"] != "bye" || event.Params["code"] != 4000 {
+		t.Errorf("Expected the client's close reason, got %v", event.Params)
+	}
+}
+
+func TestWriteErrorReason(t *testing.T) {
+	if _, reason := writeErrorReason(timeoutError{}); reason != "write timeout" {
+		t.Errorf("Expected write timeout, got %q", reason)
+	}
+	if _, reason := writeErrorReason(errors.New("broken pipe")); reason != "write error: broken pipe" {
+		t.Errorf("Expected write error, got %q", reason)
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClientKeepaliveValidation(t *testing.T) {
+	for _, config := range []CDPProxyConfig{
+		{ClientPingInterval: 30 * time.Second, ClientPongWait: 30 * time.Second},
+		{ClientPingInterval: 90 * time.Second},
+	} {
+		config.BrowserURL = "http://127.0.0.1:1"
+		if _, err := NewCDPProxy(&mockDispatcher{}, config); !errors.Is(err, ErrInvalidClientKeepalive) {
+			t.Errorf("Expected ErrInvalidClientKeepalive for ping %s and pong wait %s, got %v", config.ClientPingInterval, config.ClientPongWait, err)
+		}
+	}
+}
@@ -1,15 +1,15 @@
 package browser
 
 import (
-	"encoding/json"
 	"errors"
-	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"browsermux/internal/replay"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -53,44 +53,16 @@ func TestCDPProxyGetConfig(t *testing.T) {
 	}
 }
 
-func createMockBrowserServer() *httptest.Server {
-	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool { return true },
-	}
-
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/json/version" {
-			response := map[string]interface{}{
-				"Browser":              "Mock Browser/1.0",
-				"Protocol-Version":     "1.3",
-				"User-Agent":           "Mock Browser Agent",
-				"webSocketDebuggerUrl": "ws://localhost:9999/devtools/browser/12345",
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-			return
-		}
-
-		if strings.Contains(r.URL.Path, "/devtools/browser") {
-			conn, err := upgrader.Upgrade(w, r, nil)
-			if err != nil {
-				return
-			}
-			defer conn.Close()
-
-			for {
-				_, message, err := conn.ReadMessage()
-				if err != nil {
-					break
-				}
+// createMockBrowserServer serves a recorded CDP session, one JSONL entry per
+// line, as the browser.
+func createMockBrowserServer(t *testing.T, recording string) *httptest.Server {
+	t.Helper()
 
-				if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-					break
-				}
-			}
-		}
-	}))
+	session, err := replay.Load(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("Failed to load recording: %v", err)
+	}
+	return httptest.NewServer(replay.NewServer(session))
 }
 
 func TestNewCDPProxy(t *testing.T) {
@@ -456,3 +428,17 @@ func TestCDPProxyDisconnect(t *testing.T) {
 		t.Error("Expected browser connection to be nil after disconnect")
 	}
 }
+
+func TestNamedProxyEvents(t *testing.T) {
+	dispatcher := &mockDispatcher{}
+	named := browserDispatcher{EventDispatcher: dispatcher, browser: "chromium"}
+	named.Dispatch(Event{Type: EventBrowserReconnected})
+
+	if len(dispatcher.events) != 1 || dispatcher.events[0].Browser != "chromium" {
+		t.Errorf("Expected the event to carry the browser name, got %+v", dispatcher.events)
+	}
+
+	if name := (&CDPProxy{}).Name(); name != DefaultBrowserName {
+		t.Errorf("Expected %s for an unnamed proxy, got %s", DefaultBrowserName, name)
+	}
+}
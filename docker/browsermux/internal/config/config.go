@@ -4,14 +4,103 @@ import (
 	"encoding/json"
 	"os"
 	"strconv"
+	"strings"
 )
 
+// Keepalive defaults, applied whenever the settings are zero or missing. A
+// negative interval disables keepalive probes.
+const (
+	defaultKeepaliveIntervalSeconds = 15
+	defaultStallTimeoutSeconds      = 10
+)
+
+// defaultCommandTimeoutSeconds applies when the timeout is missing. Zero from
+// the environment or a negative value in a config file disables timeouts.
+const defaultCommandTimeoutSeconds = 30
+
+const defaultRecordingDir = "recordings"
+
 type Config struct {
 	Port string `json:"port"`
 
 	BrowserURL               string `json:"browser_url"`
 	MaxMessageSize           int    `json:"max_message_size"`
 	ConnectionTimeoutSeconds int    `json:"connection_timeout_seconds"`
+
+	LockMode              string `json:"lock_mode"`
+	AllowLockModeOverride bool   `json:"allow_lock_mode_override"`
+
+	ObserverAllowedMethods []string `json:"observer_allowed_methods,omitempty"`
+
+	SlowConsumerPolicy     string   `json:"slow_consumer_policy"`
+	SlowConsumerSampleRate int      `json:"slow_consumer_sample_rate"`
+	SampledEventMethods    []string `json:"sampled_event_methods,omitempty"`
+
+	CommandQueueSize           int `json:"command_queue_size"`
+	CommandQueueTimeoutSeconds int `json:"command_queue_timeout_seconds"`
+
+	CommandTimeoutSeconds int            `json:"command_timeout_seconds"`
+	CommandTimeouts       map[string]int `json:"command_timeouts,omitempty"`
+
+	TracingExporter string `json:"tracing_exporter"`
+	TracingEndpoint string `json:"tracing_endpoint"`
+	TracingInsecure bool   `json:"tracing_insecure"`
+	TracingFile     string `json:"tracing_file"`
+	// TracingSampleRatio is nil when unset, which records every trace.
+	TracingSampleRatio *float64 `json:"tracing_sample_ratio,omitempty"`
+
+	LogFormat string `json:"log_format"`
+	LogLevel  string `json:"log_level"`
+
+	RecordingEnabled     bool   `json:"recording_enabled"`
+	RecordingDir         string `json:"recording_dir"`
+	RecordingMaxFileSize int64  `json:"recording_max_file_size"`
+	RecordingMaxFiles    int    `json:"recording_max_files"`
+
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+
+	ReadinessTimeoutSeconds int `json:"readiness_timeout_seconds"`
+
+	ReconnectInitialDelaySeconds float64 `json:"reconnect_initial_delay_seconds"`
+	ReconnectMaxDelaySeconds     float64 `json:"reconnect_max_delay_seconds"`
+	ReconnectMultiplier          float64 `json:"reconnect_multiplier"`
+	ReconnectJitter              float64 `json:"reconnect_jitter"`
+	ReconnectMaxAttempts         int     `json:"reconnect_max_attempts"`
+	ReconnectGiveUp              string  `json:"reconnect_give_up"`
+
+	KeepaliveIntervalSeconds int `json:"keepalive_interval_seconds"`
+	StallTimeoutSeconds      int `json:"stall_timeout_seconds"`
+
+	ClientPingIntervalSeconds int `json:"client_ping_interval_seconds"`
+	ClientPongWaitSeconds     int `json:"client_pong_wait_seconds"`
+	ClientWriteWaitSeconds    int `json:"client_write_wait_seconds"`
+
+	Browsers []BrowserConfig `json:"browsers,omitempty"`
+}
+
+// BrowserConfig is an additional upstream browser, served below
+// /browsers/{name}. Zero values fall back to the top-level settings.
+type BrowserConfig struct {
+	Name                     string `json:"name"`
+	BrowserURL               string `json:"browser_url"`
+	MaxMessageSize           int    `json:"max_message_size"`
+	ConnectionTimeoutSeconds int    `json:"connection_timeout_seconds"`
+	LockMode                 string `json:"lock_mode"`
+	CommandTimeoutSeconds    int    `json:"command_timeout_seconds"`
+}
+
+// WebhookConfig is a webhook sink. Zero values fall back to the webhook
+// package defaults.
+type WebhookConfig struct {
+	Name                 string   `json:"name"`
+	URL                  string   `json:"url"`
+	Secret               string   `json:"secret"`
+	Events               []string `json:"events,omitempty"`
+	BatchSize            int      `json:"batch_size"`
+	FlushIntervalSeconds int      `json:"flush_interval_seconds"`
+	MaxQueue             int      `json:"max_queue"`
+	MaxRetries           int      `json:"max_retries"`
+	TimeoutSeconds       int      `json:"timeout_seconds"`
 }
 
 func Load() (*Config, error) {
@@ -24,6 +113,13 @@ func Load() (*Config, error) {
 
 			decoder := json.NewDecoder(file)
 			if err := decoder.Decode(config); err == nil {
+				setKeepaliveDefaults(config)
+				if config.CommandTimeoutSeconds == 0 {
+					config.CommandTimeoutSeconds = defaultCommandTimeoutSeconds
+				}
+				if config.RecordingDir == "" {
+					config.RecordingDir = defaultRecordingDir
+				}
 				return config, nil
 			}
 		}
@@ -61,14 +157,276 @@ func Load() (*Config, error) {
 		config.ConnectionTimeoutSeconds = 10
 	}
 
+	if lockMode := os.Getenv("LOCK_MODE"); lockMode != "" {
+		config.LockMode = lockMode
+	} else {
+		config.LockMode = "exclusive"
+	}
+
+	if allow := os.Getenv("ALLOW_LOCK_MODE_OVERRIDE"); allow != "" {
+		if b, err := strconv.ParseBool(allow); err == nil {
+			config.AllowLockModeOverride = b
+		}
+	}
+
+	if methods := os.Getenv("OBSERVER_ALLOWED_METHODS"); methods != "" {
+		config.ObserverAllowedMethods = splitList(methods)
+	}
+
+	if policy := os.Getenv("SLOW_CONSUMER_POLICY"); policy != "" {
+		config.SlowConsumerPolicy = policy
+	} else {
+		config.SlowConsumerPolicy = "drop_events"
+	}
+
+	if rate := os.Getenv("SLOW_CONSUMER_SAMPLE_RATE"); rate != "" {
+		if r, err := strconv.Atoi(rate); err == nil {
+			config.SlowConsumerSampleRate = r
+		}
+	}
+
+	if methods := os.Getenv("SAMPLED_EVENT_METHODS"); methods != "" {
+		config.SampledEventMethods = splitList(methods)
+	}
+
+	if size := os.Getenv("COMMAND_QUEUE_SIZE"); size != "" {
+		if n, err := strconv.Atoi(size); err == nil {
+			config.CommandQueueSize = n
+		} else {
+			config.CommandQueueSize = 100
+		}
+	} else {
+		config.CommandQueueSize = 100
+	}
+
+	if timeout := os.Getenv("COMMAND_QUEUE_TIMEOUT_SECONDS"); timeout != "" {
+		if t, err := strconv.Atoi(timeout); err == nil {
+			config.CommandQueueTimeoutSeconds = t
+		} else {
+			config.CommandQueueTimeoutSeconds = 30
+		}
+	} else {
+		config.CommandQueueTimeoutSeconds = 30
+	}
+
+	if timeout := os.Getenv("COMMAND_TIMEOUT_SECONDS"); timeout != "" {
+		if t, err := strconv.Atoi(timeout); err == nil {
+			config.CommandTimeoutSeconds = t
+		} else {
+			config.CommandTimeoutSeconds = defaultCommandTimeoutSeconds
+		}
+	} else {
+		config.CommandTimeoutSeconds = defaultCommandTimeoutSeconds
+	}
+
+	if interval := os.Getenv("KEEPALIVE_INTERVAL_SECONDS"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			config.KeepaliveIntervalSeconds = i
+		}
+	}
+
+	if timeout := os.Getenv("STALL_TIMEOUT_SECONDS"); timeout != "" {
+		if t, err := strconv.Atoi(timeout); err == nil {
+			config.StallTimeoutSeconds = t
+		}
+	}
+
+	setKeepaliveDefaults(config)
+
+	if interval := os.Getenv("CLIENT_PING_INTERVAL_SECONDS"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			config.ClientPingIntervalSeconds = i
+		}
+	}
+
+	if wait := os.Getenv("CLIENT_PONG_WAIT_SECONDS"); wait != "" {
+		if w, err := strconv.Atoi(wait); err == nil {
+			config.ClientPongWaitSeconds = w
+		} else {
+			config.ClientPongWaitSeconds = 60
+		}
+	} else {
+		config.ClientPongWaitSeconds = 60
+	}
+
+	if wait := os.Getenv("CLIENT_WRITE_WAIT_SECONDS"); wait != "" {
+		if w, err := strconv.Atoi(wait); err == nil {
+			config.ClientWriteWaitSeconds = w
+		} else {
+			config.ClientWriteWaitSeconds = 10
+		}
+	} else {
+		config.ClientWriteWaitSeconds = 10
+	}
+
+	if timeouts := os.Getenv("COMMAND_TIMEOUTS"); timeouts != "" {
+		config.CommandTimeouts = parseTimeouts(timeouts)
+	}
+
+	if exporter := os.Getenv("TRACING_EXPORTER"); exporter != "" {
+		config.TracingExporter = exporter
+	} else {
+		config.TracingExporter = "none"
+	}
+
+	config.TracingEndpoint = os.Getenv("TRACING_ENDPOINT")
+	config.TracingFile = os.Getenv("TRACING_FILE")
+
+	if insecure := os.Getenv("TRACING_INSECURE"); insecure != "" {
+		if b, err := strconv.ParseBool(insecure); err == nil {
+			config.TracingInsecure = b
+		}
+	}
+
+	if ratio := os.Getenv("TRACING_SAMPLE_RATIO"); ratio != "" {
+		if r, err := strconv.ParseFloat(ratio, 64); err == nil {
+			config.TracingSampleRatio = &r
+		}
+	}
+
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		config.LogFormat = format
+	} else {
+		config.LogFormat = "text"
+	}
+
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		config.LogLevel = level
+	} else {
+		config.LogLevel = "info"
+	}
+
+	if enabled := os.Getenv("RECORDING_ENABLED"); enabled != "" {
+		if b, err := strconv.ParseBool(enabled); err == nil {
+			config.RecordingEnabled = b
+		}
+	}
+
+	if dir := os.Getenv("RECORDING_DIR"); dir != "" {
+		config.RecordingDir = dir
+	} else {
+		config.RecordingDir = defaultRecordingDir
+	}
+
+	if size := os.Getenv("RECORDING_MAX_FILE_SIZE"); size != "" {
+		if n, err := strconv.ParseInt(size, 10, 64); err == nil {
+			config.RecordingMaxFileSize = n
+		}
+	}
+
+	if files := os.Getenv("RECORDING_MAX_FILES"); files != "" {
+		if n, err := strconv.Atoi(files); err == nil {
+			config.RecordingMaxFiles = n
+		}
+	}
+
+	if timeout := os.Getenv("READINESS_TIMEOUT_SECONDS"); timeout != "" {
+		if t, err := strconv.Atoi(timeout); err == nil {
+			config.ReadinessTimeoutSeconds = t
+		} else {
+			config.ReadinessTimeoutSeconds = 2
+		}
+	} else {
+		config.ReadinessTimeoutSeconds = 2
+	}
+
+	if delay := os.Getenv("RECONNECT_INITIAL_DELAY_SECONDS"); delay != "" {
+		if f, err := strconv.ParseFloat(delay, 64); err == nil {
+			config.ReconnectInitialDelaySeconds = f
+		}
+	}
+
+	if delay := os.Getenv("RECONNECT_MAX_DELAY_SECONDS"); delay != "" {
+		if f, err := strconv.ParseFloat(delay, 64); err == nil {
+			config.ReconnectMaxDelaySeconds = f
+		}
+	}
+
+	if multiplier := os.Getenv("RECONNECT_MULTIPLIER"); multiplier != "" {
+		if f, err := strconv.ParseFloat(multiplier, 64); err == nil {
+			config.ReconnectMultiplier = f
+		}
+	}
+
+	if jitter := os.Getenv("RECONNECT_JITTER"); jitter != "" {
+		if f, err := strconv.ParseFloat(jitter, 64); err == nil {
+			config.ReconnectJitter = f
+		}
+	}
+
+	if attempts := os.Getenv("RECONNECT_MAX_ATTEMPTS"); attempts != "" {
+		if n, err := strconv.Atoi(attempts); err == nil {
+			config.ReconnectMaxAttempts = n
+		}
+	}
+
+	config.ReconnectGiveUp = os.Getenv("RECONNECT_GIVE_UP")
+
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		config.Webhooks = []WebhookConfig{{
+			Name:   "default",
+			URL:    url,
+			Secret: os.Getenv("WEBHOOK_SECRET"),
+			Events: splitList(os.Getenv("WEBHOOK_EVENTS")),
+		}}
+	}
+
 	return config, nil
 }
 
+func setKeepaliveDefaults(config *Config) {
+	if config.KeepaliveIntervalSeconds == 0 {
+		config.KeepaliveIntervalSeconds = defaultKeepaliveIntervalSeconds
+	}
+	if config.StallTimeoutSeconds <= 0 {
+		config.StallTimeoutSeconds = defaultStallTimeoutSeconds
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseTimeouts reads "Page.printToPDF=120,Page.*=60" into seconds per method.
+// Malformed entries are skipped.
+func parseTimeouts(value string) map[string]int {
+	timeouts := make(map[string]int)
+	for _, item := range splitList(value) {
+		method, seconds, found := strings.Cut(item, "=")
+		if !found {
+			continue
+		}
+		if s, err := strconv.Atoi(strings.TrimSpace(seconds)); err == nil {
+			timeouts[strings.TrimSpace(method)] = s
+		}
+	}
+	return timeouts
+}
+
 func DefaultConfig() *Config {
 	return &Config{
-		Port:                     "8080",
-		BrowserURL:               "http://localhost:9222",
-		MaxMessageSize:           1024 * 1024,
-		ConnectionTimeoutSeconds: 10,
+		Port:                       "8080",
+		BrowserURL:                 "http://localhost:9222",
+		MaxMessageSize:             1024 * 1024,
+		ConnectionTimeoutSeconds:   10,
+		LockMode:                   "exclusive",
+		SlowConsumerPolicy:         "drop_events",
+		CommandQueueSize:           100,
+		CommandQueueTimeoutSeconds: 30,
+		CommandTimeoutSeconds:      defaultCommandTimeoutSeconds,
+		TracingExporter:            "none",
+		LogFormat:                  "text",
+		LogLevel:                   "info",
+		RecordingDir:               defaultRecordingDir,
+		KeepaliveIntervalSeconds:   defaultKeepaliveIntervalSeconds,
+		StallTimeoutSeconds:        defaultStallTimeoutSeconds,
+		ClientPongWaitSeconds:      60,
+		ClientWriteWaitSeconds:     10,
 	}
 }
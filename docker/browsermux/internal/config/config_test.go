@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeepaliveDefaults(t *testing.T) {
+	if cfg := DefaultConfig(); cfg.KeepaliveIntervalSeconds != 15 || cfg.StallTimeoutSeconds != 10 {
+		t.Errorf("DefaultConfig: expected keepalive 15s and stall timeout 10s, got %d and %d", cfg.KeepaliveIntervalSeconds, cfg.StallTimeoutSeconds)
+	}
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("CONFIG_PATH", "")
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.KeepaliveIntervalSeconds != 15 || cfg.StallTimeoutSeconds != 10 {
+			t.Errorf("Expected keepalive 15s and stall timeout 10s, got %d and %d", cfg.KeepaliveIntervalSeconds, cfg.StallTimeoutSeconds)
+		}
+
+		t.Setenv("KEEPALIVE_INTERVAL_SECONDS", "-1")
+		if cfg, _ := Load(); cfg.KeepaliveIntervalSeconds != -1 {
+			t.Errorf("Expected a negative interval to be kept, got %d", cfg.KeepaliveIntervalSeconds)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		t.Setenv("CONFIG_PATH", path)
+
+		if err := os.WriteFile(path, []byte(`{"browser_url": "http://chrome:9222"}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if cfg.BrowserURL != "http://chrome:9222" || cfg.KeepaliveIntervalSeconds != 15 || cfg.StallTimeoutSeconds != 10 {
+			t.Errorf("Expected keepalive 15s and stall timeout 10s, got %+v", cfg)
+		}
+
+		if err := os.WriteFile(path, []byte(`{"keepalive_interval_seconds": -1, "stall_timeout_seconds": 5}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if cfg, _ := Load(); cfg.KeepaliveIntervalSeconds != -1 || cfg.StallTimeoutSeconds != 5 {
+			t.Errorf("Expected the configured values, got %d and %d", cfg.KeepaliveIntervalSeconds, cfg.StallTimeoutSeconds)
+		}
+	})
+}
+
+func TestClientKeepaliveDefaults(t *testing.T) {
+	t.Setenv("CONFIG_PATH", "")
+	t.Setenv("CLIENT_PONG_WAIT_SECONDS", "30")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ClientPingIntervalSeconds != 0 || cfg.ClientPongWaitSeconds != 30 || cfg.ClientWriteWaitSeconds != 10 {
+		t.Errorf("Unexpected client keepalive settings %d, %d, %d", cfg.ClientPingIntervalSeconds, cfg.ClientPongWaitSeconds, cfg.ClientWriteWaitSeconds)
+	}
+
+	if cfg := DefaultConfig(); cfg.ClientPongWaitSeconds != 60 || cfg.ClientWriteWaitSeconds != 10 {
+		t.Errorf("DefaultConfig: unexpected client keepalive settings %+v", cfg)
+	}
+}
+
+func TestCommandTimeoutDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("CONFIG_PATH", path)
+
+	if err := os.WriteFile(path, []byte(`{"browser_url": "http://chrome:9222"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.CommandTimeoutSeconds != 30 {
+		t.Errorf("Expected a command timeout of 30s, got %d", cfg.CommandTimeoutSeconds)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"command_timeout_seconds": -1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, _ := Load(); cfg.CommandTimeoutSeconds != -1 {
+		t.Errorf("Expected a negative timeout to be kept, got %d", cfg.CommandTimeoutSeconds)
+	}
+}
+
+func TestRecordingDirDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("CONFIG_PATH", path)
+
+	if err := os.WriteFile(path, []byte(`{"recording_enabled": true}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.RecordingEnabled || cfg.RecordingDir != "recordings" {
+		t.Errorf("Expected recording into recordings, got %v and %q", cfg.RecordingEnabled, cfg.RecordingDir)
+	}
+}
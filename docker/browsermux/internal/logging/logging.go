@@ -0,0 +1,65 @@
+// Package logging configures the process-wide slog logger and names the
+// fields browsermux log records share.
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Field keys used across browsermux log records.
+const (
+	KeyClientID   = "client_id"
+	KeyMethod     = "method"
+	KeyCDPID      = "cdp_id"
+	KeySessionID  = "session_id"
+	KeyTargetID   = "target_id"
+	KeyRemoteAddr = "remote_addr"
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid log format")
+	ErrInvalidLevel  = errors.New("invalid log level")
+)
+
+// ParseLevel accepts debug, info, warn and error. An empty level selects info.
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrInvalidLevel, level)
+}
+
+// Setup installs the default slog logger writing text or JSON records at the
+// given level. The standard log package is redirected to it as well.
+func Setup(w io.Writer, format, level string) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidFormat, format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
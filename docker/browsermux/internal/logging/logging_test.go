@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]slog.Level{
+		"":        slog.LevelInfo,
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+	}
+	for input, expected := range tests {
+		level, err := ParseLevel(input)
+		if err != nil || level != expected {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", input, level, err, expected)
+		}
+	}
+
+	if _, err := ParseLevel("verbose"); !errors.Is(err, ErrInvalidLevel) {
+		t.Errorf("Expected ErrInvalidLevel, got %v", err)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	previous := slog.Default()
+	defer slog.SetDefault(previous)
+
+	if err := Setup(&bytes.Buffer{}, "xml", "info"); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Expected ErrInvalidFormat, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, "json", "warn"); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	slog.Info("dropped")
+	slog.Warn("kept", KeyClientID, "a")
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a single JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "kept" || record[KeyClientID] != "a" {
+		t.Errorf("Unexpected record %v", record)
+	}
+}
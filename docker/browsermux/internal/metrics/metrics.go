@@ -0,0 +1,147 @@
+// Package metrics holds the Prometheus collectors browsermux exposes on
+// /metrics.
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "browsermux"
+
+// DefaultBrowser is the browser label of the browser configured with
+// browser_url. Additional browsers are labelled with their configured name.
+const DefaultBrowser = "default"
+
+// Message directions.
+const (
+	DirectionClientToBrowser = "client_to_browser"
+	DirectionBrowserToClient = "browser_to_client"
+)
+
+// Reasons a message was dropped.
+const (
+	DropClientQueueFull     = "client_queue_full"
+	DropSampled             = "sampled"
+	DropSlowConsumer        = "slow_consumer"
+	DropCommandQueueFull    = "command_queue_full"
+	DropCommandQueueExpired = "command_queue_expired"
+	DropLateResponse        = "late_response"
+)
+
+var (
+	ClientsConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clients_connected",
+		Help:      "Connected WebSocket clients by browser and role.",
+	}, []string{"browser", "role"})
+
+	BrowserConnected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "browser_connected",
+		Help:      "Whether the upstream browser connection is up (1) or down (0).",
+	}, []string{"browser"})
+
+	ReconnectAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "browser_reconnect_attempts_total",
+		Help:      "Attempts to reconnect to the browser by browser and result.",
+	}, []string{"browser", "result"})
+
+	BrowserStalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "browser_stalls_total",
+		Help:      "Times the browser stopped responding and the connection was dropped.",
+	}, []string{"browser"})
+
+	Messages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_total",
+		Help:      "CDP messages relayed by browser and direction.",
+	}, []string{"browser", "direction"})
+
+	Bytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "message_bytes_total",
+		Help:      "CDP message bytes relayed by browser and direction.",
+	}, []string{"browser", "direction"})
+
+	DroppedMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_messages_total",
+		Help:      "Messages dropped by browser and reason.",
+	}, []string{"browser", "reason"})
+
+	InFlightCommands = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inflight_commands",
+		Help:      "Commands waiting for a browser response by browser.",
+	}, []string{"browser"})
+
+	CommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "Time from forwarding a command to the browser until its response, by browser and CDP method.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"browser", "method"})
+)
+
+// Registry holds the browsermux collectors plus the Go runtime and process
+// collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ClientsConnected,
+		BrowserConnected,
+		ReconnectAttempts,
+		BrowserStalls,
+		Messages,
+		Bytes,
+		DroppedMessages,
+		InFlightCommands,
+		CommandDuration,
+	)
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// cdpMethod matches well-formed CDP method names, keeping clients from
+// inflating label cardinality with made-up methods.
+var cdpMethod = regexp.MustCompile(`^[A-Z][A-Za-z]*\.[a-z][A-Za-z]*$`)
+
+// MethodLabel returns the method as a label value, or "other" for names that
+// do not look like CDP methods.
+func MethodLabel(method string) string {
+	if len(method) > 64 || !cdpMethod.MatchString(method) {
+		return "other"
+	}
+	return method
+}
+
+// RegisterBrowser exposes the series of a browser before its first
+// connection, without resetting them.
+func RegisterBrowser(browser string) {
+	BrowserConnected.WithLabelValues(browser).Add(0)
+	InFlightCommands.WithLabelValues(browser).Add(0)
+}
+
+// RecordMessage counts a message relayed for the browser.
+func RecordMessage(browser, direction string, size int) {
+	Messages.WithLabelValues(browser, direction).Inc()
+	Bytes.WithLabelValues(browser, direction).Add(float64(size))
+}
+
+// RecordDrop counts a message dropped for the browser.
+func RecordDrop(browser, reason string) {
+	DroppedMessages.WithLabelValues(browser, reason).Inc()
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMethodLabel(t *testing.T) {
+	tests := []struct {
+		method string
+		want   string
+	}{
+		{"Page.navigate", "Page.navigate"},
+		{"DOMSnapshot.captureSnapshot", "DOMSnapshot.captureSnapshot"},
+		{"page.navigate", "other"},
+		{"Page.navigate/../x", "other"},
+		{"NoDot", "other"},
+		{"Page." + strings.Repeat("a", 80), "other"},
+	}
+
+	for _, tt := range tests {
+		if got := MethodLabel(tt.method); got != tt.want {
+			t.Errorf("MethodLabel(%q) = %q, want %q", tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestRegisterBrowser(t *testing.T) {
+	// Only browsers that exist have a connection series.
+	if count := testutil.CollectAndCount(BrowserConnected); count != 0 {
+		t.Errorf("Expected no browser_connected series before a browser is registered, got %d", count)
+	}
+
+	BrowserConnected.WithLabelValues("chromium").Set(1)
+	RegisterBrowser("chromium")
+	if connected := testutil.ToFloat64(BrowserConnected.WithLabelValues("chromium")); connected != 1 {
+		t.Errorf("Expected registering to keep the connection state, got %v", connected)
+	}
+	if count := testutil.CollectAndCount(InFlightCommands); count != 1 {
+		t.Errorf("Expected an inflight_commands series for chromium, got %d", count)
+	}
+
+	RecordMessage("chromium", DirectionClientToBrowser, 10)
+	RecordMessage("firefox", DirectionClientToBrowser, 5)
+	if bytes := testutil.ToFloat64(Bytes.WithLabelValues("chromium", DirectionClientToBrowser)); bytes != 10 {
+		t.Errorf("Expected 10 bytes for chromium, got %v", bytes)
+	}
+}
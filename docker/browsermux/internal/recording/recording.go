@@ -0,0 +1,311 @@
+// Package recording writes the CDP traffic browsermux relays to rotating JSONL
+// files, so failed runs can be inspected after the fact.
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"browsermux/internal/browser"
+)
+
+const (
+	DefaultMaxFileSize = 100 * 1024 * 1024
+	DefaultMaxFiles    = 10
+
+	filePrefix = "browsermux-"
+	fileSuffix = ".jsonl"
+)
+
+// DirectionEvent marks records of proxy events from the event dispatcher.
+const DirectionEvent = "event"
+
+var (
+	ErrNotRecording     = errors.New("recording is not running")
+	ErrAlreadyRecording = errors.New("recording is already running")
+	ErrFileNotFound     = errors.New("recording file not found")
+)
+
+type Config struct {
+	Dir string
+	// MaxFileSize is the size in bytes at which a new file is started.
+	MaxFileSize int64
+	// MaxFiles is how many files are kept; older ones are deleted on rotation.
+	MaxFiles int
+}
+
+// Entry is one line of a recording.
+type Entry struct {
+	Timestamp time.Time       `json:"ts"`
+	Direction string          `json:"direction"`
+	ClientID  string          `json:"client_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// FileInfo describes a recording file on disk.
+type FileInfo struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+type Status struct {
+	Recording   bool       `json:"recording"`
+	Dir         string     `json:"dir"`
+	CurrentFile string     `json:"current_file,omitempty"`
+	Files       []FileInfo `json:"files"`
+}
+
+// Recorder implements browser.MessageRecorder. It does nothing until started.
+type Recorder struct {
+	config Config
+	active atomic.Bool
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	seq  int
+}
+
+func NewRecorder(config Config) *Recorder {
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = DefaultMaxFileSize
+	}
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = DefaultMaxFiles
+	}
+	return &Recorder{config: config}
+}
+
+// Subscribe records the proxy events of the dispatcher. CDP commands and
+// events are left out, the raw messages already cover them.
+func (r *Recorder) Subscribe(dispatcher browser.EventDispatcher) {
+	dispatcher.Register("*", func(event browser.Event) {
+		if event.Type == browser.EventCDPCommand || event.Type == browser.EventCDPEvent {
+			return
+		}
+		r.RecordEvent(event)
+	})
+}
+
+// Start opens a new recording file.
+func (r *Recorder) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		return ErrAlreadyRecording
+	}
+
+	if err := os.MkdirAll(r.config.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	if err := r.openFile(); err != nil {
+		return err
+	}
+
+	r.active.Store(true)
+	return nil
+}
+
+// Stop closes the current recording file.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return ErrNotRecording
+	}
+
+	r.active.Store(false)
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *Recorder) Recording() bool {
+	return r.active.Load()
+}
+
+// RecordMessage writes a raw CDP message relayed for a client.
+func (r *Recorder) RecordMessage(direction, clientID string, message []byte) {
+	if !r.active.Load() {
+		return
+	}
+
+	payload := json.RawMessage(message)
+	if !json.Valid(message) {
+		payload, _ = json.Marshal(string(message))
+	}
+
+	r.write(Entry{
+		Timestamp: time.Now(),
+		Direction: direction,
+		ClientID:  clientID,
+		Payload:   payload,
+	})
+}
+
+// RecordEvent writes a proxy event.
+func (r *Recorder) RecordEvent(event browser.Event) {
+	if !r.active.Load() {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	clientID := ""
+	if event.SourceType == "client" {
+		clientID = event.SourceID
+	}
+
+	r.write(Entry{
+		Timestamp: event.Timestamp,
+		Direction: DirectionEvent,
+		ClientID:  clientID,
+		Payload:   payload,
+	})
+}
+
+func (r *Recorder) write(entry Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return
+	}
+
+	if r.size > 0 && r.size+int64(len(line)) > r.config.MaxFileSize {
+		r.file.Close()
+		r.file = nil
+		if err := r.openFile(); err != nil {
+			r.active.Store(false)
+			return
+		}
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		r.active.Store(false)
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+// openFile starts a new file and deletes the oldest ones beyond MaxFiles.
+// The caller holds r.mu.
+func (r *Recorder) openFile() error {
+	r.seq++
+	name := fmt.Sprintf("%s%s-%03d%s", filePrefix, time.Now().UTC().Format("20060102T150405Z"), r.seq, fileSuffix)
+
+	file, err := os.OpenFile(filepath.Join(r.config.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open recording file: %w", err)
+	}
+	r.file = file
+	r.size = 0
+
+	files, err := r.files()
+	if err != nil {
+		return nil
+	}
+	for len(files) > r.config.MaxFiles {
+		os.Remove(filepath.Join(r.config.Dir, files[0].Name))
+		files = files[1:]
+	}
+	return nil
+}
+
+// Status reports whether recording is running and the files on disk.
+func (r *Recorder) Status() (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := Status{Recording: r.file != nil, Dir: r.config.Dir, Files: []FileInfo{}}
+	if r.file != nil {
+		status.CurrentFile = filepath.Base(r.file.Name())
+	}
+
+	files, err := r.files()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return status, err
+	}
+	if files != nil {
+		status.Files = files
+	}
+	return status, nil
+}
+
+// Open returns a recording file by name for download. Only files the recorder
+// wrote can be opened.
+func (r *Recorder) Open(name string) (*os.File, error) {
+	if name != filepath.Base(name) || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, name)
+	}
+
+	file, err := os.Open(filepath.Join(r.config.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, name)
+	}
+	return file, err
+}
+
+// files lists the recording files, oldest first.
+func (r *Recorder) files() ([]FileInfo, error) {
+	entries, err := os.ReadDir(r.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []FileInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, FileInfo{Name: name, Size: info.Size(), Modified: info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		iStamp, iSeq := fileOrder(files[i].Name)
+		jStamp, jSeq := fileOrder(files[j].Name)
+		if iStamp != jStamp {
+			return iStamp < jStamp
+		}
+		return iSeq < jSeq
+	})
+	return files, nil
+}
+
+// fileOrder splits a file name into its UTC timestamp and sequence number,
+// which order the files by age. The sequence number is compared as a number,
+// since it outgrows its three digits after enough rotations.
+func fileOrder(name string) (string, int) {
+	stem := strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix)
+	stamp, seq, _ := strings.Cut(stem, "-")
+	n, _ := strconv.Atoi(seq)
+	return stamp, n
+}
@@ -0,0 +1,143 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"browsermux/internal/browser"
+)
+
+func readEntries(t *testing.T, r *Recorder, name string) []Entry {
+	t.Helper()
+
+	file, err := r.Open(name)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid JSONL line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(Config{Dir: t.TempDir()})
+
+	r.RecordMessage("client_to_browser", "a", []byte(`{"id":1}`))
+	if err := r.Stop(); !errors.Is(err, ErrNotRecording) {
+		t.Errorf("Expected ErrNotRecording, got %v", err)
+	}
+
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := r.Start(); !errors.Is(err, ErrAlreadyRecording) {
+		t.Errorf("Expected ErrAlreadyRecording, got %v", err)
+	}
+
+	r.RecordMessage("client_to_browser", "a", []byte(`{"id":1,"method":"Page.navigate"}`))
+	r.RecordMessage("browser_to_client", "a", []byte(`not json`))
+	r.RecordEvent(browser.Event{Type: browser.EventClientConnected, SourceType: "client", SourceID: "a", Timestamp: time.Now()})
+
+	status, err := r.Status()
+	if err != nil || !status.Recording || len(status.Files) != 1 || status.CurrentFile != status.Files[0].Name {
+		t.Fatalf("Unexpected status %+v, %v", status, err)
+	}
+
+	if err := r.Stop(); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	r.RecordMessage("client_to_browser", "a", []byte(`{"id":2}`))
+
+	entries := readEntries(t, r, status.CurrentFile)
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if entries[0].Direction != "client_to_browser" || entries[0].ClientID != "a" || string(entries[0].Payload) != `{"id":1,"method":"Page.navigate"}` {
+		t.Errorf("Unexpected first entry %+v", entries[0])
+	}
+	if string(entries[1].Payload) != `"not json"` {
+		t.Errorf("Expected invalid JSON to be recorded as a string, got %s", entries[1].Payload)
+	}
+	if entries[2].Direction != DirectionEvent || entries[2].ClientID != "a" {
+		t.Errorf("Unexpected event entry %+v", entries[2])
+	}
+}
+
+func TestRecorderRotation(t *testing.T) {
+	r := NewRecorder(Config{Dir: t.TempDir(), MaxFileSize: 200, MaxFiles: 2})
+	if err := r.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer r.Stop()
+
+	for i := 0; i < 20; i++ {
+		r.RecordMessage("browser_to_client", "a", []byte(`{"method":"Page.frameNavigated","params":{}}`))
+	}
+
+	status, err := r.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(status.Files) != 2 {
+		t.Fatalf("Expected rotation to keep 2 files, got %d", len(status.Files))
+	}
+	if status.Files[1].Name != status.CurrentFile {
+		t.Errorf("Expected newest file %s to be current, got %s", status.Files[1].Name, status.CurrentFile)
+	}
+	for _, file := range status.Files {
+		if file.Size > 200 {
+			t.Errorf("File %s exceeds the size limit: %d bytes", file.Name, file.Size)
+		}
+	}
+}
+
+func TestRecorderFileOrder(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"browsermux-20250101T000000Z-999.jsonl",
+		"browsermux-20250101T000000Z-1000.jsonl",
+		"browsermux-20250101T000001Z-1001.jsonl",
+	}
+	for _, name := range []string{names[2], names[0], names[1]} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, err := NewRecorder(Config{Dir: dir}).Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(status.Files) != len(names) {
+		t.Fatalf("Expected %d files, got %d", len(names), len(status.Files))
+	}
+	for i, name := range names {
+		if status.Files[i].Name != name {
+			t.Errorf("Expected file %d to be %s, got %s", i, name, status.Files[i].Name)
+		}
+	}
+}
+
+func TestRecorderOpen(t *testing.T) {
+	r := NewRecorder(Config{Dir: t.TempDir()})
+
+	for _, name := range []string{"../etc/passwd", "browsermux-x.log", "other.jsonl", "browsermux-missing.jsonl"} {
+		if _, err := r.Open(name); !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("Open(%q): expected ErrFileNotFound, got %v", name, err)
+		}
+	}
+}
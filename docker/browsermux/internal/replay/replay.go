@@ -0,0 +1,214 @@
+// Package replay serves a recorded CDP session as a mock browser. Commands are
+// matched to the recording by method and params and answered with the recorded
+// response and the events that followed it.
+//
+// Recordings hold what clients sent and received. Commands the proxy issued on
+// its own, such as the Target.attachToTarget of a page client, are not in
+// them and are answered with an error on replay.
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+const (
+	directionClientToBrowser = "client_to_browser"
+	directionBrowserToClient = "browser_to_client"
+
+	// cdpServerError is the code of commands the recording has no answer for.
+	cdpServerError = -32000
+)
+
+// entry is a line of a recording, as written by the recording package.
+type entry struct {
+	Direction string          `json:"direction"`
+	ClientID  string          `json:"client_id"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// message is a CDP message. ID is nil when the message has none, since 0 is a
+// valid command id.
+type message struct {
+	ID        *int                   `json:"id,omitempty"`
+	Method    string                 `json:"method,omitempty"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	SessionID string                 `json:"sessionId,omitempty"`
+}
+
+// exchange is a recorded command with what the browser sent back for it.
+type exchange struct {
+	method   string
+	params   map[string]interface{}
+	response json.RawMessage
+	events   []json.RawMessage
+}
+
+// Session is a recording loaded for replay.
+type Session struct {
+	exchanges []*exchange
+}
+
+// LoadFile reads a JSONL recording.
+func LoadFile(path string) (*Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer file.Close()
+
+	return Load(file)
+}
+
+// Load reads a JSONL recording. Commands are paired with the response carrying
+// the same id on the same client, and with the events that client received
+// before its next command.
+func Load(r io.Reader) (*Session, error) {
+	byClient := make(map[string][]entry)
+	var clientOrder []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid recording line %d: %w", line, err)
+		}
+		if e.Direction != directionClientToBrowser && e.Direction != directionBrowserToClient {
+			continue
+		}
+
+		if _, seen := byClient[e.ClientID]; !seen {
+			clientOrder = append(clientOrder, e.ClientID)
+		}
+		byClient[e.ClientID] = append(byClient[e.ClientID], e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	session := &Session{}
+	for _, clientID := range clientOrder {
+		session.exchanges = append(session.exchanges, exchangesOf(byClient[clientID])...)
+	}
+	return session, nil
+}
+
+func exchangesOf(entries []entry) []*exchange {
+	var exchanges []*exchange
+	var current *exchange
+	pending := make(map[int]*exchange)
+
+	for _, e := range entries {
+		var msg message
+		if err := json.Unmarshal(e.Payload, &msg); err != nil {
+			continue
+		}
+
+		switch {
+		case e.Direction == directionClientToBrowser && msg.ID != nil && msg.Method != "":
+			current = &exchange{method: msg.Method, params: msg.Params}
+			exchanges = append(exchanges, current)
+			pending[*msg.ID] = current
+		case e.Direction == directionBrowserToClient && msg.ID != nil && msg.Method == "":
+			if cmd, ok := pending[*msg.ID]; ok {
+				cmd.response = e.Payload
+				delete(pending, *msg.ID)
+			}
+		case e.Direction == directionBrowserToClient && msg.Method != "" && current != nil:
+			current.events = append(current.events, e.Payload)
+		}
+	}
+	return exchanges
+}
+
+// Len returns the number of recorded commands.
+func (s *Session) Len() int {
+	return len(s.exchanges)
+}
+
+// player tracks which recorded commands one connection has already replayed.
+type player struct {
+	session *Session
+	used    map[*exchange]bool
+}
+
+func newPlayer(session *Session) *player {
+	return &player{session: session, used: make(map[*exchange]bool)}
+}
+
+// answer returns the messages to send back for a command: the recorded
+// response with the command's id and sessionId, followed by the recorded
+// events. The first unused exchange with the same method and params wins; once
+// all are used the last one is repeated.
+func (p *player) answer(cmd *message) [][]byte {
+	var match *exchange
+	for _, ex := range p.session.exchanges {
+		if ex.method != cmd.Method || !sameParams(ex.params, cmd.Params) {
+			continue
+		}
+		match = ex
+		if !p.used[ex] {
+			break
+		}
+	}
+
+	if match == nil || match.response == nil {
+		return [][]byte{errorResponse(cmd, fmt.Sprintf("replay: no recorded response for '%s'", cmd.Method))}
+	}
+	p.used[match] = true
+
+	response, err := rewriteResponse(match.response, cmd)
+	if err != nil {
+		return [][]byte{errorResponse(cmd, err.Error())}
+	}
+
+	messages := [][]byte{response}
+	for _, event := range match.events {
+		messages = append(messages, event)
+	}
+	return messages
+}
+
+func sameParams(recorded, received map[string]interface{}) bool {
+	if len(recorded) == 0 && len(received) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(recorded, received)
+}
+
+func rewriteResponse(recorded json.RawMessage, cmd *message) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(recorded, &fields); err != nil {
+		return nil, err
+	}
+
+	id, _ := json.Marshal(cmd.ID)
+	fields["id"] = id
+	delete(fields, "sessionId")
+	if cmd.SessionID != "" {
+		sessionID, _ := json.Marshal(cmd.SessionID)
+		fields["sessionId"] = sessionID
+	}
+	return json.Marshal(fields)
+}
+
+func errorResponse(cmd *message, text string) []byte {
+	response := map[string]interface{}{
+		"id":    cmd.ID,
+		"error": map[string]interface{}{"code": cdpServerError, "message": text},
+	}
+	if cmd.SessionID != "" {
+		response["sessionId"] = cmd.SessionID
+	}
+	data, _ := json.Marshal(response)
+	return data
+}
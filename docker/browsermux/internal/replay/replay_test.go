@@ -0,0 +1,109 @@
+package replay
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const recording = `
+{"ts":"2025-01-01T00:00:00Z","direction":"event","payload":{"type":"client.connected"}}
+{"ts":"2025-01-01T00:00:00Z","direction":"client_to_browser","client_id":"a","payload":{"id":1,"method":"Page.navigate","params":{"url":"https://example.com"}}}
+{"ts":"2025-01-01T00:00:00Z","direction":"browser_to_client","client_id":"a","payload":{"method":"Page.frameStartedLoading","params":{"frameId":"F1"}}}
+{"ts":"2025-01-01T00:00:00Z","direction":"browser_to_client","client_id":"a","payload":{"id":1,"result":{"frameId":"F1","loaderId":"L1"}}}
+{"ts":"2025-01-01T00:00:01Z","direction":"client_to_browser","client_id":"a","payload":{"id":2,"method":"Page.navigate","params":{"url":"https://example.com"}}}
+{"ts":"2025-01-01T00:00:01Z","direction":"browser_to_client","client_id":"a","payload":{"id":2,"result":{"frameId":"F1","loaderId":"L2"}}}
+{"ts":"2025-01-01T00:00:02Z","direction":"client_to_browser","client_id":"b","payload":{"id":1,"method":"Browser.getVersion"}}
+{"ts":"2025-01-01T00:00:02Z","direction":"browser_to_client","client_id":"b","payload":{"id":1,"result":{"product":"Chrome/120"}}}
+{"ts":"2025-01-01T00:00:03Z","direction":"client_to_browser","client_id":"c","payload":{"id":0,"method":"Target.getTargets"}}
+{"ts":"2025-01-01T00:00:03Z","direction":"browser_to_client","client_id":"c","payload":{"id":0,"result":{"targetInfos":[]}}}
+`
+
+func TestLoad(t *testing.T) {
+	session, err := Load(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if session.Len() != 4 {
+		t.Errorf("Expected 4 recorded commands, got %d", session.Len())
+	}
+	if last := session.exchanges[3]; last.method != "Target.getTargets" || last.response == nil {
+		t.Errorf("Expected the command with id 0 to be paired with its response, got %+v", last)
+	}
+
+	if _, err := Load(strings.NewReader("not json\n")); err == nil {
+		t.Error("Expected an error for a malformed recording")
+	}
+}
+
+func TestServer(t *testing.T) {
+	session, err := Load(strings.NewReader(recording))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	server := httptest.NewServer(NewServer(session))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/json/version")
+	if err != nil {
+		t.Fatalf("GET /json/version failed: %v", err)
+	}
+	var version map[string]string
+	json.NewDecoder(resp.Body).Decode(&version)
+	resp.Body.Close()
+
+	wsURL := version["webSocketDebuggerUrl"]
+	if !strings.HasPrefix(wsURL, "ws://"+strings.TrimPrefix(server.URL, "http://")) {
+		t.Fatalf("Unexpected webSocketDebuggerUrl %q", wsURL)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial replay browser: %v", err)
+	}
+	defer conn.Close()
+
+	exchange := func(command string, expected ...string) {
+		t.Helper()
+
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(command)); err != nil {
+			t.Fatalf("Failed to send command: %v", err)
+		}
+		for _, want := range expected {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("Failed to read reply to %s: %v", command, err)
+			}
+			for _, part := range strings.Split(want, "|") {
+				if !strings.Contains(string(data), part) {
+					t.Errorf("Expected reply to %s to contain %s, got %s", command, part, data)
+				}
+			}
+		}
+	}
+
+	// Recorded responses come back with the id of the replayed command,
+	// followed by the events recorded after the command.
+	exchange(`{"id":7,"method":"Page.navigate","params":{"url":"https://example.com"}}`,
+		`"id":7|"loaderId":"L1"`,
+		`"method":"Page.frameStartedLoading"`)
+
+	// Identical commands replay in recorded order, then repeat the last one.
+	exchange(`{"id":8,"method":"Page.navigate","params":{"url":"https://example.com"}}`, `"id":8|"loaderId":"L2"`)
+	exchange(`{"id":9,"method":"Page.navigate","params":{"url":"https://example.com"}}`, `"id":9|"loaderId":"L2"`)
+
+	exchange(`{"id":10,"method":"Browser.getVersion","sessionId":"S1"}`, `"id":10|"sessionId":"S1"|Chrome/120`)
+
+	// Zero is a valid command id.
+	exchange(`{"id":0,"method":"Target.getTargets"}`, `"id":0|"targetInfos"`)
+
+	// Params are part of the match.
+	exchange(`{"id":11,"method":"Page.navigate","params":{"url":"https://other.example"}}`, `"id":11|"code":-32000|Page.navigate`)
+}
@@ -0,0 +1,86 @@
+package replay
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"browsermux/internal/logging"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Server serves /json/version and a browser WebSocket on /devtools/ that
+// answers from a recorded session. Every connection replays the recording
+// from the start.
+type Server struct {
+	session *Session
+}
+
+func NewServer(session *Session) *Server {
+	return &Server{session: session}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/json/version":
+		s.handleVersion(w, r)
+	case r.URL.Path == "/json" || r.URL.Path == "/json/list":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	case strings.HasPrefix(r.URL.Path, "/devtools/"):
+		s.handleWebSocket(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	version := map[string]string{
+		"Browser":              "BrowserMux Replay",
+		"Protocol-Version":     "1.3",
+		"User-Agent":           "BrowserMux Replay",
+		"webSocketDebuggerUrl": "ws://" + r.Host + "/devtools/browser/replay",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(version); err != nil {
+		slog.Warn("Error writing JSON response", "path", r.URL.Path, "error", err)
+	}
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Warn("Error upgrading connection to WebSocket", logging.KeyRemoteAddr, r.RemoteAddr, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	p := newPlayer(s.session)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var cmd message
+		if err := json.Unmarshal(data, &cmd); err != nil || cmd.ID == nil || cmd.Method == "" {
+			continue
+		}
+
+		answers := p.answer(&cmd)
+		slog.Debug("Replaying command", logging.KeyMethod, cmd.Method, logging.KeyCDPID, *cmd.ID, "messages", len(answers))
+
+		for _, answer := range answers {
+			if err := conn.WriteMessage(websocket.TextMessage, answer); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+)
+
+func TestSetup(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "zipkin"}); !errors.Is(err, ErrInvalidExporter) {
+		t.Errorf("Expected ErrInvalidExporter, got %v", err)
+	}
+
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatalf("Setup(none) failed: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	shutdown, err = Setup(context.Background(), Config{Exporter: ExporterFile, FilePath: path})
+	if err != nil {
+		t.Fatalf("Setup(file) failed: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "Page.navigate")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) == 0 {
+		t.Errorf("Expected spans in %s, got %q (%v)", path, data, err)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	ratio := func(r float64) *float64 { return &r }
+
+	tests := []struct {
+		ratio *float64
+		want  string
+	}{
+		{nil, "AlwaysOnSampler"},
+		{ratio(0), "AlwaysOffSampler"},
+		{ratio(0.5), "TraceIDRatioBased{0.5}"},
+		{ratio(1), "AlwaysOnSampler"},
+	}
+	for _, tt := range tests {
+		if got := sampler(tt.ratio).Description(); got != tt.want {
+			t.Errorf("sampler(%v) = %s, want %s", tt.ratio, got, tt.want)
+		}
+	}
+}
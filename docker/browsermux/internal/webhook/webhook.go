@@ -0,0 +1,386 @@
+// Package webhook delivers dispatcher events to HTTP endpoints in signed,
+// batched POSTs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"browsermux/internal/browser"
+)
+
+const (
+	DefaultBatchSize     = 50
+	DefaultFlushInterval = time.Second
+	DefaultMaxQueue      = 1000
+	DefaultMaxRetries    = 5
+	DefaultTimeout       = 10 * time.Second
+)
+
+// cdpEventPrefix marks the relayed CDP traffic, which sinks only receive when
+// they subscribe to it explicitly.
+const cdpEventPrefix = "cdp."
+
+// Backoff between retries of a batch, doubling up to maxBackoff.
+var (
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// Request headers. The signature is the hex HMAC-SHA256 of the body keyed
+// with the sink's secret, prefixed with "sha256=". The delivery ID stays the
+// same across retries of a batch.
+const (
+	HeaderSignature = "X-Browsermux-Signature"
+	HeaderDelivery  = "X-Browsermux-Delivery"
+	HeaderWebhook   = "X-Browsermux-Webhook"
+)
+
+type Config struct {
+	Name   string
+	URL    string
+	Secret string
+	// Events are the event types to deliver, exact or "*" suffix patterns.
+	// Empty delivers every event except the high-volume cdp.* events, which
+	// need a pattern that names them, such as "cdp.*" or "*".
+	Events []string
+
+	BatchSize     int
+	FlushInterval time.Duration
+	// MaxQueue bounds the events waiting for delivery; newer events are
+	// dropped once it is full.
+	MaxQueue int
+	// MaxRetries is how often a failed batch is retried; zero uses the
+	// default, a negative value disables retries.
+	MaxRetries int
+	Timeout    time.Duration
+}
+
+// Payload is the body of a delivery.
+type Payload struct {
+	Webhook string          `json:"webhook"`
+	SentAt  time.Time       `json:"sent_at"`
+	Events  []browser.Event `json:"events"`
+}
+
+// Status reports the delivery state of a sink.
+type Status struct {
+	Name        string     `json:"name"`
+	URL         string     `json:"url"`
+	Events      []string   `json:"events"`
+	Queued      int        `json:"queued"`
+	Delivered   uint64     `json:"delivered"`
+	Failed      uint64     `json:"failed"`
+	Dropped     uint64     `json:"dropped"`
+	Retries     uint64     `json:"retries"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// Sink delivers the events matching its config to one URL.
+type Sink struct {
+	config Config
+	client *http.Client
+
+	mu     sync.Mutex
+	queue  []browser.Event
+	status Status
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewSink(config Config) (*Sink, error) {
+	if config.URL == "" {
+		return nil, errors.New("webhook needs a URL")
+	}
+	if config.Name == "" {
+		config.Name = config.URL
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	if config.MaxQueue <= 0 {
+		config.MaxQueue = DefaultMaxQueue
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	events := config.Events
+	if events == nil {
+		events = []string{}
+	}
+
+	return &Sink{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		status: Status{Name: config.Name, URL: config.URL, Events: events},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+func (s *Sink) matches(event browser.Event) bool {
+	if len(s.config.Events) == 0 {
+		return !strings.HasPrefix(string(event.Type), cdpEventPrefix)
+	}
+	for _, pattern := range s.config.Events {
+		if browser.MatchesEventType(pattern, event.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// Enqueue queues an event for delivery if the sink subscribes to its type.
+func (s *Sink) Enqueue(event browser.Event) {
+	if !s.matches(event) {
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.queue) >= s.config.MaxQueue {
+		s.status.Dropped++
+		s.mu.Unlock()
+		return
+	}
+	s.queue = append(s.queue, event)
+	full := len(s.queue) >= s.config.BatchSize
+	s.mu.Unlock()
+
+	if full {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Sink) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := s.status
+	status.Queued = len(s.queue)
+	return status
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		case <-s.stop:
+			// One last attempt for whatever is still queued.
+			for batch := s.nextBatch(); len(batch) > 0; batch = s.nextBatch() {
+				s.deliver(batch, false)
+			}
+			return
+		}
+
+		for batch := s.nextBatch(); len(batch) > 0; batch = s.nextBatch() {
+			s.deliver(batch, true)
+		}
+	}
+}
+
+func (s *Sink) nextBatch() []browser.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := min(len(s.queue), s.config.BatchSize)
+	batch := make([]browser.Event, n)
+	copy(batch, s.queue[:n])
+	s.queue = s.queue[n:]
+	return batch
+}
+
+// deliver posts a batch, retrying with exponential backoff until MaxRetries
+// is used up or the sink is stopped.
+func (s *Sink) deliver(batch []browser.Event, retry bool) {
+	// The dispatcher runs handlers concurrently, so events can be queued
+	// slightly out of order.
+	sort.SliceStable(batch, func(i, j int) bool { return batch[i].Timestamp.Before(batch[j].Timestamp) })
+
+	body, err := json.Marshal(Payload{Webhook: s.config.Name, SentAt: time.Now(), Events: batch})
+	if err != nil {
+		s.recordFailure(len(batch), err)
+		return
+	}
+	deliveryID := uuid.NewString()
+
+	backoff := initialBackoff
+	for attempt := 0; ; attempt++ {
+		err = s.post(body, deliveryID)
+		if err == nil {
+			s.recordSuccess(len(batch))
+			return
+		}
+
+		if !retry || attempt >= s.config.MaxRetries {
+			break
+		}
+
+		s.mu.Lock()
+		s.status.Retries++
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(backoff):
+		case <-s.stop:
+			retry = false
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+
+	slog.Warn("Webhook delivery failed", "webhook", s.config.Name, "events", len(batch), "error", err)
+	s.recordFailure(len(batch), err)
+}
+
+func (s *Sink) post(body []byte, deliveryID string) error {
+	req, err := http.NewRequest(http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "browsermux-webhook")
+	req.Header.Set(HeaderWebhook, s.config.Name)
+	req.Header.Set(HeaderDelivery, deliveryID)
+	if s.config.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(s.config.Secret, body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Sink) recordSuccess(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Delivered += uint64(n)
+	now := time.Now()
+	s.status.LastSuccess = &now
+}
+
+func (s *Sink) recordFailure(n int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Failed += uint64(n)
+	s.status.LastError = err.Error()
+	now := time.Now()
+	s.status.LastErrorAt = &now
+}
+
+// Sign returns the signature header value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Manager runs the configured sinks.
+type Manager struct {
+	sinks   []*Sink
+	started bool
+}
+
+func NewManager(configs []Config) (*Manager, error) {
+	m := &Manager{}
+	for _, config := range configs {
+		sink, err := NewSink(config)
+		if err != nil {
+			return nil, fmt.Errorf("webhook %q: %w", config.Name, err)
+		}
+		m.sinks = append(m.sinks, sink)
+	}
+	return m, nil
+}
+
+// Start subscribes the sinks to the dispatcher and starts delivering.
+func (m *Manager) Start(dispatcher browser.EventDispatcher) {
+	if len(m.sinks) == 0 {
+		return
+	}
+
+	m.started = true
+	for _, sink := range m.sinks {
+		go sink.run()
+	}
+
+	dispatcher.Register("*", func(event browser.Event) {
+		for _, sink := range m.sinks {
+			sink.Enqueue(event)
+		}
+	})
+}
+
+// Stop makes a final delivery attempt for queued events and waits for the
+// sinks until ctx is done.
+func (m *Manager) Stop(ctx context.Context) error {
+	if !m.started {
+		return nil
+	}
+
+	for _, sink := range m.sinks {
+		close(sink.stop)
+	}
+	for _, sink := range m.sinks {
+		select {
+		case <-sink.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (m *Manager) Status() []Status {
+	statuses := make([]Status, 0, len(m.sinks))
+	for _, sink := range m.sinks {
+		statuses = append(statuses, sink.Status())
+	}
+	return statuses
+}
@@ -0,0 +1,191 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"browsermux/internal/browser"
+)
+
+type receiver struct {
+	mu         sync.Mutex
+	payloads   []Payload
+	deliveries []string
+	failures   int
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.deliveries = append(r.deliveries, req.Header.Get(HeaderDelivery))
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var payload Payload
+	json.Unmarshal(body, &payload)
+	r.payloads = append(r.payloads, payload)
+
+	if req.Header.Get(HeaderSignature) != Sign("secret", body) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func (r *receiver) received() []Payload {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Payload(nil), r.payloads...)
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for webhook delivery")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManagerDeliversSignedBatches(t *testing.T) {
+	rec := &receiver{}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	manager, err := NewManager([]Config{{
+		Name:          "control-plane",
+		URL:           server.URL,
+		Secret:        "secret",
+		Events:        []string{"client.disconnected", "browser.*"},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	}})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	dispatcher := browser.NewEventDispatcher()
+	manager.Start(dispatcher)
+
+	now := time.Now()
+	dispatcher.Dispatch(browser.Event{Type: browser.EventCDPEvent, Method: "Page.loadEventFired", Timestamp: now})
+	dispatcher.Dispatch(browser.Event{Type: browser.EventClientDisconnected, SourceID: "a", Timestamp: now})
+	dispatcher.Dispatch(browser.Event{Type: browser.EventBrowserDisconnected, Timestamp: now.Add(time.Millisecond)})
+
+	// A full batch is sent without waiting for the flush interval.
+	waitFor(t, func() bool { return len(rec.received()) == 1 })
+
+	payload := rec.received()[0]
+	if payload.Webhook != "control-plane" || len(payload.Events) != 2 {
+		t.Fatalf("Unexpected payload %+v", payload)
+	}
+	if payload.Events[0].Type != browser.EventClientDisconnected || payload.Events[1].Type != browser.EventBrowserDisconnected {
+		t.Errorf("Expected events in timestamp order, got %s, %s", payload.Events[0].Type, payload.Events[1].Type)
+	}
+
+	status := manager.Status()[0]
+	if status.Delivered != 2 || status.Failed != 0 || status.LastSuccess == nil {
+		t.Errorf("Unexpected status %+v", status)
+	}
+
+	// Stopping flushes what is left.
+	dispatcher.Dispatch(browser.Event{Type: browser.EventBrowserReconnected, Timestamp: now})
+	waitFor(t, func() bool { return manager.Status()[0].Queued == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := manager.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if got := len(rec.received()); got != 2 {
+		t.Errorf("Expected the queued event to be flushed on stop, got %d deliveries", got)
+	}
+}
+
+func TestSinkRetriesWithBackoff(t *testing.T) {
+	previous := initialBackoff
+	initialBackoff = 10 * time.Millisecond
+	defer func() { initialBackoff = previous }()
+
+	rec := &receiver{failures: 2}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	sink, err := NewSink(Config{URL: server.URL, Secret: "secret", MaxRetries: 3})
+	if err != nil {
+		t.Fatalf("NewSink failed: %v", err)
+	}
+
+	sink.deliver([]browser.Event{{Type: browser.EventClientConnected}}, true)
+
+	status := sink.Status()
+	if status.Delivered != 1 || status.Retries != 2 {
+		t.Errorf("Expected delivery after 2 retries, got %+v", status)
+	}
+	if len(rec.deliveries) != 3 || rec.deliveries[0] != rec.deliveries[2] {
+		t.Errorf("Expected 3 attempts with one delivery ID, got %v", rec.deliveries)
+	}
+
+	rec.failures = 10
+	sink.deliver([]browser.Event{{Type: browser.EventClientConnected}}, true)
+
+	status = sink.Status()
+	if status.Failed != 1 || status.LastError == "" || status.LastErrorAt == nil {
+		t.Errorf("Expected the batch to fail after MaxRetries, got %+v", status)
+	}
+}
+
+func TestSinkQueueIsBounded(t *testing.T) {
+	sink, err := NewSink(Config{URL: "http://127.0.0.1:0", Events: []string{"*"}, MaxQueue: 2, BatchSize: 10})
+	if err != nil {
+		t.Fatalf("NewSink failed: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		sink.Enqueue(browser.Event{Type: browser.EventCDPCommand})
+	}
+
+	status := sink.Status()
+	if status.Queued != 2 || status.Dropped != 3 {
+		t.Errorf("Expected 2 queued and 3 dropped, got %+v", status)
+	}
+
+	if _, err := NewSink(Config{}); err == nil {
+		t.Error("Expected an error for a webhook without URL")
+	}
+}
+
+func TestSinkDefaultSubscription(t *testing.T) {
+	sink, err := NewSink(Config{URL: "http://127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("NewSink failed: %v", err)
+	}
+
+	for _, eventType := range []browser.EventType{browser.EventCDPCommand, browser.EventCDPEvent, browser.EventCDPTimeout} {
+		if sink.matches(browser.Event{Type: eventType}) {
+			t.Errorf("Expected %s to need an explicit subscription", eventType)
+		}
+	}
+	if !sink.matches(browser.Event{Type: browser.EventClientDisconnected}) || !sink.matches(browser.Event{Type: browser.EventBrowserStalled}) {
+		t.Error("Expected lifecycle events to be delivered by default")
+	}
+
+	sink.config.Events = []string{"cdp.*"}
+	if !sink.matches(browser.Event{Type: browser.EventCDPEvent}) {
+		t.Error("Expected cdp.* to subscribe to CDP events")
+	}
+}